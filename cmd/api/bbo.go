@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/crypto_pickle/internal/analytics"
+	"github.com/crypto_pickle/internal/export"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/gin-gonic/gin"
+)
+
+// GetBBO serves the best bid and ask of every frame of a window, e.g.
+// /get-bbo?symbol=btcusdt&start=2023-06-01T12:00:00&end=2023-06-01T15:00:00&changes=true
+// With changes=true only frames where the price or quantity of the best bid or
+// ask changed are returned. freq is 10 (default) or 1 frames per second. Like
+// /get-candles, histories are streamed from the store at depth 1 so windows can
+// be hours long. The response is columnar,
+// {"Symbol":"btcusdt","Time":[...],"BidPrice":[...],"BidQty":[...],"AskPrice":[...],"AskQty":[...]}
+// with null for an empty side.
+func GetBBO(c *gin.Context) {
+	symbol, start, end, err := parseStreamWindow(c, MAX_BBO_WINDOW)
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+
+	freq := 10
+	if freq_param := c.Query("freq"); freq_param != "" {
+		if freq, err = strconv.Atoi(freq_param); err != nil || (freq != 10 && freq != 1) {
+			c.AbortWithError(400, errors.New("freq parameter can only be 10 or 1"))
+			return
+		}
+	}
+
+	changes, err := strconv.ParseBool(c.DefaultQuery("changes", "false"))
+	if err != nil {
+		c.AbortWithError(400, errors.New("changes parameter must be true or false"))
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Warning: %s", r)
+			c.AbortWithStatus(500)
+		}
+	}()
+
+	var res struct {
+		Symbol   string
+		Time     []int64
+		BidPrice metricColumn
+		BidQty   metricColumn
+		AskPrice metricColumn
+		AskQty   metricColumn
+	}
+	res.Symbol, res.Time = symbol, make([]int64, 0)
+
+	var prev orderbook.OrderBookSmall
+	err = export.Frames(store, symbol, start, end, 1, freq, func(obs []orderbook.OrderBookSmall) error {
+		for _, ob := range obs {
+			if changes && len(res.Time) > 0 && analytics.SameTopOfBook(prev, ob) {
+				continue
+			}
+			prev = ob
+
+			res.Time = append(res.Time, ob.Time)
+			res.BidPrice = append(res.BidPrice, analytics.BestBid(ob))
+			res.BidQty = append(res.BidQty, analytics.BestBidQty(ob))
+			res.AskPrice = append(res.AskPrice, analytics.BestAsk(ob))
+			res.AskQty = append(res.AskQty, analytics.BestAskQty(ob))
+		}
+
+		return nil
+	})
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.JSON(200, res)
+}
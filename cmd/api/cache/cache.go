@@ -1,7 +1,6 @@
 package cache
 
 import (
-	"container/list"
 	"errors"
 	"sync"
 	"time"
@@ -48,7 +47,7 @@ func (c *Cache) ScheduleUpdateIndex(duration time.Duration) {
 }
 
 func (c *Cache) download(e *IndexElement) {
-	newData := DownloadOrderBooks(c.client, c.symbol, e.key, e.format)
+	newData := DownloadOrderBooks(c.client, c.symbol, e.key)
 
 	c.lru.Insert(e.key, newData)
 	e.downloaded = true
@@ -94,22 +93,36 @@ func (c *Cache) SelectWindow(t int, depth, freq int) []orderbook.OrderBookSmall
 	return c.lru.Select(e.key, depth, freq)
 }
 
-func (c *Cache) SelectTime(t int, depth, freq int) orderbook.OrderBookSmall {
+func (c *Cache) SelectTime(t int, depth int) (orderbook.OrderBookSmall, error) {
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
-	window := c.SelectWindow(t, depth, freq)
-	i := orderbook.OrderBookSmallArray(window).GetTimeIndex(int64(t))
+	e, _ := c.index.FindKey(t)
+	if e == nil {
+		return orderbook.OrderBookSmall{}, errors.New("unable to find time: " + utils.UnixMilliToDateTimeString(t))
+	}
+
+	if !e.downloaded {
+		c.download(e)
+	}
 
-	return window[i]
+	ob, ok := c.lru.SelectTime(e.key, int64(t), depth)
+	if !ok {
+		return orderbook.OrderBookSmall{}, errors.New("unable to find time: " + utils.UnixMilliToDateTimeString(t))
+	}
+
+	return ob, nil
 }
 
 func (c *Cache) GetAvailableTimes() (int, int) {
 	return c.index.GetEarliestTime(), c.index.GetLatestTime()
 }
 
+// Select returns the frames between t1 and t2, stitched together from every
+// window the range spans.
 func (c *Cache) Select(t1, t2 int, depth, freq int) ([]orderbook.OrderBookSmall, error) {
-	selection, resLen := list.New(), 0
+	stitcher := orderbook.NewStitcher(int64(t1), int64(t2))
+	res := make([]orderbook.OrderBookSmall, 0)
 
 	c.mut.Lock()
 	defer c.mut.Unlock()
@@ -118,72 +131,24 @@ func (c *Cache) Select(t1, t2 int, depth, freq int) ([]orderbook.OrderBookSmall,
 
 	e, i := c.index.FindKey(t1)
 	if e == nil {
-		return []orderbook.OrderBookSmall{}, errors.New("unable to find time: " + utils.UnixMilliToDateTimeString(t1))
-	}
-
-	if !e.downloaded {
-		c.download(e)
+		return res, errors.New("unable to find time: " + utils.UnixMilliToDateTimeString(t1))
 	}
 
-	winData := c.lru.Select(e.key, depth, freq)
-
-	selection.PushFront(winData)
-	resLen += len(winData)
-
-	for e != nil && e.end < t2 {
-		e, i = c.index.GetNext(i), i+1
-		if e == nil {
-			return []orderbook.OrderBookSmall{}, errors.New("unable to find time: " + utils.UnixMilliToDateTimeString(t2))
-		}
-
+	for {
 		if !e.downloaded {
 			c.download(e)
 		}
 
-		winData = c.lru.Select(e.key, depth, freq)
-
-		selection.PushFront(winData)
-		resLen += len(winData)
-	}
+		res = append(res, stitcher.Add(c.lru.Select(e.key, depth, freq))...)
+		if stitcher.Done(int64(e.end)) {
+			return res, nil
+		}
 
-	// convert selection to a single array
-
-	res := make([]orderbook.OrderBookSmall, resLen)
-
-	if selection.Len() == 1 {
-		window := selection.Front().Value.([]orderbook.OrderBookSmall)
-		i0, i1 := orderbook.OrderBookSmallArray(window).GetTimeIndex(int64(t1)), orderbook.OrderBookSmallArray(window).GetTimeIndex(int64(t2))
-
-		res = window[i0 : i1+1]
-	} else {
-		ptr := 0
-		for e := selection.Back(); e.Prev() != nil; e = e.Prev() {
-			if e.Next() == nil { // The first window
-				window := e.Value.([]orderbook.OrderBookSmall)
-				i0 := orderbook.OrderBookSmallArray(window).GetTimeIndex(int64(t1))
-
-				for ; ptr < len(window)-i0; ptr += 1 {
-					res[ptr] = window[i0+ptr]
-				}
-			} else if e.Prev() == nil { // The last window
-				window := e.Value.([]orderbook.OrderBookSmall)
-				i1 := orderbook.OrderBookSmallArray(window).GetTimeIndex(int64(t1))
-
-				for i := 0; i < i1; i += 1 {
-					res[ptr] = window[i]
-					ptr += 1
-				}
-			} else {
-				window := e.Value.([]orderbook.OrderBookSmall)
-				for i := 0; i < len(window); i += 1 {
-					res[ptr] = window[i]
-					ptr += 1
-				}
-			}
+		e, i = c.index.GetNext(i), i+1
+		if e == nil {
+			return res, errors.New("unable to find time: " + utils.UnixMilliToDateTimeString(t2))
 		}
 	}
-
-	return res, nil
 }
 
 func (c *Cache) GetInfo() []string {
@@ -1,11 +1,13 @@
 package cache
 
 import (
+	"log"
 	"sort"
-	"strconv"
 	"strings"
 
+	"github.com/crypto_pickle/internal/orderbook"
 	"github.com/crypto_pickle/internal/s3_client"
+	"github.com/crypto_pickle/internal/storage"
 )
 
 type IndexElement struct {
@@ -29,27 +31,41 @@ func (index Index) Swap(i, j int) {
 }
 
 func (index Index) Less(i, j int) bool {
-	return index[i].end < index[i].start
+	return index[i].start < index[j].start
 }
 
 // General Functions
 
 func NewIndex(client *s3_client.S3Client, symbol string) Index {
-	fileList := client.ListObjects("datapickles", symbol)
+	fileList := client.ListObjects("datapickles", symbol+"/")
+
+	newIndex := make(Index, 0, len(fileList))
+	for _, s := range fileList {
+		key, err := storage.ParseKey(s)
+		if err != nil {
+			log.Printf("skipping %s: %s \n", s, err)
+			continue
+		}
+
+		if key.Symbol != symbol {
+			continue
+		}
+
+		// files in a format the api can't decode are left out of the index
+		if _, err := orderbook.GetCodec(key.Format); err != nil {
+			log.Printf("skipping %s: %s \n", s, err)
+			continue
+		}
 
-	newIndex := make(Index, len(fileList))
-	for i, s := range fileList {
-		withoutSym := strings.Split(s, "/")[1]
-		withoutFormat := strings.Split(withoutSym, ".")
+		var element IndexElement
 
-		format := withoutFormat[1]
-		times := strings.Split(withoutFormat[0], "-")
+		element.key = strings.TrimPrefix(s, symbol+"/")
+		element.format = key.Format
+		element.start = int(key.Start)
+		element.end = int(key.End)
+		element.downloaded = false
 
-		newIndex[i].key = withoutSym
-		newIndex[i].format = format
-		newIndex[i].start, _ = strconv.Atoi(times[0])
-		newIndex[i].end, _ = strconv.Atoi(times[1])
-		newIndex[i].downloaded = false
+		newIndex = append(newIndex, element)
 	}
 
 	sort.Sort(newIndex)
@@ -65,7 +81,7 @@ func TransferElements(old_index *Index, new_index *Index) {
 		} else if (*new_index)[i].start > (*old_index)[j].start {
 			j++
 		} else {
-			(*new_index)[i].downloaded = (*old_index)[i].downloaded
+			(*new_index)[i].downloaded = (*old_index)[j].downloaded
 
 			i++
 			j++
@@ -13,6 +13,9 @@ type cacheElement struct {
 	key      string
 	lastUsed int64
 
+	hist orderbook.OrderBookHistory
+	// data holds the reconstructed frames of hist. It is only built once a
+	// whole window is selected, single frames are read from hist's keyframes.
 	data []orderbook.OrderBookSmall
 
 	lruPtr *list.Element
@@ -34,12 +37,12 @@ func NewLru(size int) *Lru {
 	}
 }
 
-func (c *Lru) Insert(key string, data []orderbook.OrderBookSmall) {
+func (c *Lru) Insert(key string, hist orderbook.OrderBookHistory) {
 	newCacheElement := &cacheElement{
 		key:      key,
 		lastUsed: time.Now().UnixMilli(),
 
-		data: data,
+		hist: hist,
 	}
 
 	c.mut.Lock()
@@ -49,19 +52,52 @@ func (c *Lru) Insert(key string, data []orderbook.OrderBookSmall) {
 	newCacheElement.lruPtr = c.lruList.PushFront(newCacheElement)
 }
 
-func (c *Lru) Select(key string, depth, freq int) []orderbook.OrderBookSmall {
-	c.mut.Lock()
-	defer c.mut.Unlock()
-
+func (c *Lru) get(key string) *cacheElement {
 	val, ok := c.cacheMap[key]
 	if !ok {
 		log.Fatalf("Key %s not found in cache}", key)
 	}
 
 	val.lastUsed = time.Now().UnixMilli()
-	c.lruList.MoveToFront(c.cacheMap[key].lruPtr)
+	c.lruList.MoveToFront(val.lruPtr)
+
+	return val
+}
+
+func (c *Lru) Select(key string, depth, freq int) []orderbook.OrderBookSmall {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	val := c.get(key)
+	if val.data == nil {
+		val.data = val.hist.ToSmallArray(true)
+	}
+
+	return []orderbook.OrderBookSmall(orderbook.OrderBookSmallArray(val.data).Cut(depth, freq))
+}
+
+// SelectTime returns the book at time t, seeking from the nearest keyframe
+// unless the window has already been reconstructed.
+func (c *Lru) SelectTime(key string, t int64, depth int) (orderbook.OrderBookSmall, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	val := c.get(key)
+	if val.data != nil {
+		i := orderbook.OrderBookSmallArray(val.data).GetTimeIndex(t)
+		if i < 0 {
+			return orderbook.OrderBookSmall{}, false
+		}
+
+		return val.data[i].Cut(depth), true
+	}
+
+	ob, ok := val.hist.BookAtTime(t)
+	if !ok {
+		return orderbook.OrderBookSmall{}, false
+	}
 
-	return []orderbook.OrderBookSmall(orderbook.OrderBookSmallArray(c.cacheMap[key].data).Cut(depth, freq))
+	return ob.ToOrderBookSmall(depth), true
 }
 
 func (c *Lru) Clear() []string {
@@ -1,21 +1,59 @@
 package cache
 
 import (
+	"io"
+	"log"
+
 	"github.com/crypto_pickle/internal/orderbook"
 	"github.com/crypto_pickle/internal/s3_client"
 )
 
-func DownloadOrderBooks(client *s3_client.S3Client, symbol string, key string, format string) []orderbook.OrderBookSmall {
-	bytes := client.DownloadData("datapickles", symbol+"/"+key)
+// DownloadOrderBooks streams a history from the bucket, decoding frames as they
+// arrive rather than after the whole object has been downloaded. The codec is
+// read from the file header.
+func DownloadOrderBooks(client *s3_client.S3Client, symbol string, key string) orderbook.OrderBookHistory {
+	body, err := client.OpenData("datapickles", symbol+"/"+key)
+	if err != nil {
+		log.Printf("failed to download data %s/%s: %s", symbol, key, err)
+		return orderbook.OrderBookHistory{}
+	}
+	defer body.Close()
+
+	header, dec, err := orderbook.OpenFile(body)
+	if err != nil {
+		log.Printf("failed to decode %s/%s: %s", symbol, key, err)
+		return orderbook.OrderBookHistory{}
+	}
+	defer dec.Close()
+
+	hist := orderbook.OrderBookHistory{
+		Symbol:           dec.Symbol,
+		Start:            dec.Start,
+		SnapshotUpdateId: header.SnapshotUpdateId,
+		Gap:              header.Gap,
+		GapBefore:        header.GapBefore,
+		History:          make([]orderbook.DepthDiff, 0, 1024),
+	}
+
+	// a history cut short by a decoding error keeps the frames before it
+	for {
+		diff, err := dec.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Printf("failed to decode %s/%s: %s", symbol, key, err)
+			break
+		}
+
+		hist.History = append(hist.History, diff)
+	}
 
-	var hist orderbook.OrderBookHistory
-	if format == "msgpack" {
-		hist = orderbook.HistFromMsgPack(bytes)
-	} else if format == "json" {
-		hist = orderbook.HistFromMsgPack(bytes)
-	} else if format == "bin" {
-		hist = orderbook.HistFromBytes(bytes)
+	// files with an index store their keyframes, older ones are rebuilt
+	if dec.Keyframes != nil {
+		hist.KeyframeInterval, hist.Keyframes = dec.KeyframeInterval, dec.Keyframes
+	} else {
+		hist.BuildKeyframes(dec.KeyframeInterval)
 	}
 
-	return hist.ToSmallArray(true)
+	return hist
 }
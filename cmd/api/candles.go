@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+
+	"github.com/crypto_pickle/internal/analytics"
+	"github.com/crypto_pickle/internal/export"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/gin-gonic/gin"
+)
+
+// GetCandles builds OHLC candles of a price series with spread statistics per
+// bar, e.g.
+// /get-candles?symbol=btcusdt&start=2023-06-01T00:00:00&end=2023-06-01T06:00:00&interval=5m&source=mid
+// interval is between 1s and 1d (default 1m) and source one of mid, microprice,
+// bid or ask (default mid). Candles only need the best level of each side, so
+// histories are streamed from the store at depth 1 rather than selected through
+// the cache, which allows much longer windows.
+func GetCandles(c *gin.Context) {
+	symbol, start, end, err := parseStreamWindow(c, MAX_CANDLES_WINDOW)
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+
+	interval, err := analytics.ParseInterval(c.DefaultQuery("interval", "1m"))
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+
+	source, err := analytics.ParseCandleSource(c.DefaultQuery("source", "mid"))
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Warning: %s", r)
+			c.AbortWithStatus(500)
+		}
+	}()
+
+	builder := analytics.NewCandleBuilder(interval, source)
+	candles := make([]analytics.Candle, 0)
+
+	err = export.Frames(store, symbol, start, end, 1, 10, func(obs []orderbook.OrderBookSmall) error {
+		candles = append(candles, builder.Add(obs)...)
+		return nil
+	})
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.JSON(200, append(candles, builder.Flush()...))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/crypto_pickle/internal/export"
+	"github.com/crypto_pickle/internal/heatmap"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/gin-gonic/gin"
+)
+
+// GetHeatmap renders a PNG of the liquidity of a book over time, e.g.
+// /get-heatmap?symbol=btcusdt&start=2023-06-01T12:00:00&end=2023-06-01T12:30:00&low=26800&high=27200&width=1200&height=600
+// See heatmap.Heatmap. freq is 10 or 1 (default) frames per second.
+func GetHeatmap(c *gin.Context) {
+	symbol, start, end, err := parseStreamWindow(c, MAX_HEATMAP_WINDOW)
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+
+	low, err := strconv.ParseFloat(c.Query("low"), 64)
+	if err != nil {
+		c.AbortWithError(400, errors.New("query parameter 'low' must be a price"))
+		return
+	}
+
+	high, err := strconv.ParseFloat(c.Query("high"), 64)
+	if err != nil {
+		c.AbortWithError(400, errors.New("query parameter 'high' must be a price"))
+		return
+	}
+
+	width, err := strconv.Atoi(c.DefaultQuery("width", "1200"))
+	if err != nil || width <= 0 || width > MAX_HEATMAP_SIZE {
+		c.AbortWithError(400, errors.New("width parameter must be between 1 and 4000"))
+		return
+	}
+
+	height, err := strconv.Atoi(c.DefaultQuery("height", "600"))
+	if err != nil || height <= 0 || height > MAX_HEATMAP_SIZE {
+		c.AbortWithError(400, errors.New("height parameter must be between 1 and 4000"))
+		return
+	}
+
+	freq, err := strconv.Atoi(c.DefaultQuery("freq", "1"))
+	if err != nil || (freq != 10 && freq != 1) {
+		c.AbortWithError(400, errors.New("freq parameter can only be 10 or 1"))
+		return
+	}
+
+	h, err := heatmap.New(start, end, low, high, width, height)
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Warning: %s", r)
+			c.AbortWithStatus(500)
+		}
+	}()
+
+	// every level inside [low, high] may be needed
+	err = export.Frames(store, symbol, start, end, orderbook.MAX_DEPTH, freq, func(obs []orderbook.OrderBookSmall) error {
+		h.Add(obs)
+		return nil
+	})
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.Header("Content-Type", "image/png")
+	c.Status(200)
+
+	if err := h.Encode(c.Writer); err != nil {
+		log.Printf("failed to write heatmap: %s", err)
+	}
+}
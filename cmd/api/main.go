@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/crypto_pickle/cmd/api/cache"
 	"github.com/crypto_pickle/cmd/api/utils"
+	"github.com/crypto_pickle/internal/export"
+	"github.com/crypto_pickle/internal/orderbook"
 	"github.com/crypto_pickle/internal/s3_client"
+	"github.com/crypto_pickle/internal/storage"
 	"github.com/gin-contrib/pprof"
 
 	"github.com/gin-gonic/gin"
@@ -20,11 +23,21 @@ import (
 const (
 	CACHE_SIZE       = 4                    // should be ~50 mb per minute, so this should be 0.5 gb per symbol. Current version runs 10 symbols so this should be 5 gb cache right now.
 	MAX_REQUEST_SIZE = 10 * 15 * 100 * 5000 // 10 frames per second x 15 second x 100 ms per frame x 5000 levels per frame
+
+	ARROW_BATCH_FRAMES = 1000                // frames per record batch of arrow responses
+	MAX_METRICS_WINDOW = 1000 * 60 * 60      // metrics are cheap to send but every frame is replayed with every level
+	MAX_CANDLES_WINDOW = 1000 * 60 * 60 * 24 // candles stream every file of the window, longer ranges can be built with export candles
+	MAX_BBO_WINDOW     = 1000 * 60 * 60 * 6  // a frame of the best bid and ask is tiny, so hours can be served at once
+	MAX_HEATMAP_WINDOW = 1000 * 60 * 60      // heatmaps need every level of every frame
+	MAX_HEATMAP_SIZE   = 4000                // pixels per side of a heatmap
 )
 
 var symbolList []string
 var symbolCache map[string]*cache.Cache
 
+// store streams histories for endpoints that read more than the cache holds
+var store storage.Store
+
 var prof *string = flag.String("prof", "false", "Whether to enable profiling or not")
 var debug *string = flag.String("debug", "false", "Whether to enable debug endpoints")
 var release *string = flag.String("release", "false", "Whether to enable gin release mode or not")
@@ -37,6 +50,7 @@ func init() {
 
 	// set up symbol list
 	symbolList = utils.GetSymbolList(client, "datapickles")
+	store = storage.NewS3(&client, "datapickles")
 
 	// set up cache
 	symbolCache = make(map[string]*cache.Cache)
@@ -60,6 +74,10 @@ func main() {
 	router.GET("/get-symbol-list", getSymbols)
 	router.GET("/get-symbol-info", getSymbolInfo)
 	router.GET("/get-orderbooks", GetOrderBooks)
+	router.GET("/get-metrics", GetMetrics)
+	router.GET("/get-candles", GetCandles)
+	router.GET("/get-bbo", GetBBO)
+	router.GET("/get-heatmap", GetHeatmap)
 
 	if *prof == "true" {
 		pprof.Register(router)
@@ -107,85 +125,45 @@ func getSymbolInfo(c *gin.Context) {
 
 func GetOrderBooks(c *gin.Context) {
 	// expects a symbol parameter, start parameter and end parameter
-	symbol := c.Query("symbol")
-	if symbol == "" {
-		c.AbortWithError(400, errors.New("query parameter 'symbol' required"))
-	}
-
-	start_param := c.Query("start")
-	if start_param == "" {
-		c.AbortWithError(400, errors.New("query parameter 'start' required"))
+	w, err := parseWindow(c)
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
 	}
 
-	start, err := utils.DateTimeStringToUnixMilli(start_param)
+	depth, err := parseDepth(c, 1000)
 	if err != nil {
 		c.AbortWithError(400, err)
 		return
 	}
 
-	var end int
-	if end_param := c.Query("end"); end_param != "" {
-		end, err = utils.DateTimeStringToUnixMilli(end_param)
+	// levels are aggregated over the full depth of the book before it is cut
+	var aggregation *orderbook.Aggregation
+	selectDepth := depth
+	if aggregate_param := c.Query("aggregate"); aggregate_param != "" {
+		agg, err := orderbook.ParseAggregation(aggregate_param)
 		if err != nil {
 			c.AbortWithError(400, err)
 			return
-		} else if end < start {
-			c.AbortWithError(400, errors.New("query parameter 'end' must be before query parameter 'start'"))
-			return
 		}
-	} else {
-		end = start
-	}
 
-	depth_param := c.Query("depth")
-
-	var depth int
-	if depth_param != "" {
-		depth64, err := (strconv.ParseInt(depth_param, 10, 64))
-		if err != nil {
-			c.AbortWithError(400, errors.New("depth parameter must be an integer"))
-			return
-		} else if depth64 > 5000 || depth64 < 0 {
-			c.AbortWithError(400, errors.New("depth parameter must be between 0 and 5000"))
-			return
-		}
-
-		depth = int(depth64)
-	} else {
-		depth = 1000
+		aggregation, selectDepth = &agg, orderbook.MAX_DEPTH
 	}
 
-	freq_param := c.Query("freq")
-
-	var freq int
-	if freq_param != "" {
-		freq64, err := (strconv.ParseInt(freq_param, 10, 64))
-		if err != nil {
-			c.AbortWithError(400, errors.New("freq parameter must be an integer"))
-			return
-		} else if freq64 != 10 && freq64 != 1 {
-			c.AbortWithError(400, errors.New("freq parameter can only be 10 or 1"))
-			return
-		}
-
-		freq = int(freq64)
-	} else {
-		freq = 1
+	// the size is that of the selected books, aggregation selects every level
+	if w.span()*selectDepth > MAX_REQUEST_SIZE {
+		c.AbortWithError(400, fmt.Errorf("requested window is too big! Maximum window is %d ms long", MAX_REQUEST_SIZE/selectDepth))
+		return
 	}
 
-	if (end-start)*depth > MAX_REQUEST_SIZE {
-		c.AbortWithError(400, fmt.Errorf("requested window is too big! Maximum window is %d ms long", MAX_REQUEST_SIZE))
+	layout := c.DefaultQuery("layout", export.LAYOUT_WIDE)
+	if layout != export.LAYOUT_WIDE && layout != export.LAYOUT_LONG {
+		c.AbortWithError(400, errors.New("layout parameter can only be wide or long"))
 		return
 	}
 
 	// logic starts here
 
-	cachePtr, ok := symbolCache[symbol]
-	if !ok {
-		c.AbortWithError(400, errors.New("symbol not found"))
-		return
-	}
-
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Warning: %s", r)
@@ -193,11 +171,52 @@ func GetOrderBooks(c *gin.Context) {
 		}
 	}()
 
-	orderbooks, err := cachePtr.Select(start, end, depth, freq)
+	orderbooks, err := w.selectBooks(selectDepth)
 	if err != nil {
 		c.AbortWithError(400, err)
 		return
 	}
 
+	if aggregation != nil {
+		aggregated := make([]orderbook.OrderBookSmall, len(orderbooks))
+		for i, ob := range orderbooks {
+			aggregated[i] = ob.Aggregate(*aggregation).Cut(depth)
+		}
+		orderbooks = aggregated
+	}
+
+	if strings.Contains(c.GetHeader("Accept"), export.ARROW_STREAM_MIME) {
+		writeArrow(c, w.symbol, orderbooks, layout, depth)
+		return
+	}
+
 	c.JSON(200, orderbooks)
 }
+
+// writeArrow responds with an Arrow IPC stream of the books, see export.BookSchema.
+func writeArrow(c *gin.Context, symbol string, orderbooks []orderbook.OrderBookSmall, layout string, depth int) {
+	w, err := export.NewArrowWriter(c.Writer, layout, depth)
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	c.Header("Content-Type", export.ARROW_STREAM_MIME)
+	c.Status(200)
+
+	for i := 0; i < len(orderbooks); i += ARROW_BATCH_FRAMES {
+		j := i + ARROW_BATCH_FRAMES
+		if j > len(orderbooks) {
+			j = len(orderbooks)
+		}
+
+		if err := w.Write(symbol, orderbooks[i:j]); err != nil {
+			log.Printf("failed to write arrow stream: %s", err)
+			return
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		log.Printf("failed to write arrow stream: %s", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/crypto_pickle/internal/analytics"
+	"github.com/crypto_pickle/internal/export"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/gin-gonic/gin"
+)
+
+// metricColumn is a metric series in JSON, undefined values are written as null.
+type metricColumn []float64
+
+func (col metricColumn) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 0, 2+12*len(col))
+
+	buf = append(buf, '[')
+	for i, v := range col {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			buf = append(buf, "null"...)
+		} else {
+			buf = strconv.AppendFloat(buf, v, 'f', -1, 64)
+		}
+	}
+
+	return append(buf, ']'), nil
+}
+
+// GetMetrics computes metrics of every frame of a window server side, e.g.
+// /get-metrics?symbol=btcusdt&start=2023-06-01T12:00:00&end=2023-06-01T12:30:00&metrics=mid,spread,imbalance10,depth50bps
+// See analytics.ParseMetric for the metric names. Histories are streamed from
+// the store with every level and the metrics computed one history at a time,
+// so no window of full books is held at once. The response is columnar,
+// {"Symbol":"btcusdt","Time":[...],"Metrics":{"mid":[...],"spread":[...]}}
+func GetMetrics(c *gin.Context) {
+	w, err := parseWindow(c)
+	if err != nil {
+		c.AbortWithError(400, err)
+		return
+	}
+
+	if w.span() > MAX_METRICS_WINDOW {
+		c.AbortWithError(400, fmt.Errorf("requested window is too big! Maximum window is %d ms long", MAX_METRICS_WINDOW))
+		return
+	}
+
+	metrics_param := c.Query("metrics")
+	if metrics_param == "" {
+		c.AbortWithError(400, errors.New("query parameter 'metrics' required"))
+		return
+	}
+
+	metrics := make(map[string]analytics.Metric)
+	columns := make(map[string]metricColumn)
+	for _, name := range strings.Split(metrics_param, ",") {
+		if metrics[name], err = analytics.ParseMetric(name); err != nil {
+			c.AbortWithError(400, err)
+			return
+		}
+
+		columns[name] = make(metricColumn, 0)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Warning: %s", r)
+			c.AbortWithStatus(500)
+		}
+	}()
+
+	times := make([]int64, 0)
+	add := func(obs []orderbook.OrderBookSmall) {
+		for _, ob := range obs {
+			times = append(times, ob.Time)
+			for name, metric := range metrics {
+				columns[name] = append(columns[name], metric(ob))
+			}
+		}
+	}
+
+	// metrics such as depth within bps may need every level
+	err = export.Frames(store, w.symbol, int64(w.start), int64(w.end), orderbook.MAX_DEPTH, w.freq, func(obs []orderbook.OrderBookSmall) error {
+		if w.resampler != nil {
+			obs = w.resampler.Add(obs)
+		}
+
+		add(obs)
+		return nil
+	})
+	if err != nil {
+		c.AbortWithError(500, err)
+		return
+	}
+
+	if w.resampler != nil {
+		add(w.resampler.Flush(int64(w.end)))
+	}
+
+	c.JSON(200, struct {
+		Symbol  string
+		Time    []int64
+		Metrics map[string]metricColumn
+	}{
+		Symbol:  w.symbol,
+		Time:    times,
+		Metrics: columns,
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/crypto_pickle/cmd/api/cache"
+	"github.com/crypto_pickle/cmd/api/utils"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/gin-gonic/gin"
+)
+
+// window holds the query parameters shared by every endpoint reading frames:
+// symbol, start, end and either freq or period with resample.
+type window struct {
+	symbol string
+	cache  *cache.Cache
+
+	start int
+	end   int
+
+	freq      int
+	period    int64
+	resampler *orderbook.Resampler
+}
+
+func parseWindow(c *gin.Context) (window, error) {
+	var w window
+
+	w.symbol = c.Query("symbol")
+	if w.symbol == "" {
+		return w, errors.New("query parameter 'symbol' required")
+	}
+
+	var ok bool
+	if w.cache, ok = symbolCache[w.symbol]; !ok {
+		return w, errors.New("symbol not found")
+	}
+
+	start_param := c.Query("start")
+	if start_param == "" {
+		return w, errors.New("query parameter 'start' required")
+	}
+
+	var err error
+	if w.start, err = utils.DateTimeStringToUnixMilli(start_param); err != nil {
+		return w, err
+	}
+
+	if end_param := c.Query("end"); end_param != "" {
+		if w.end, err = utils.DateTimeStringToUnixMilli(end_param); err != nil {
+			return w, err
+		} else if w.end < w.start {
+			return w, errors.New("query parameter 'end' must be before query parameter 'start'")
+		}
+	} else {
+		w.end = w.start
+	}
+
+	freq_param := c.Query("freq")
+	if freq_param != "" {
+		freq64, err := strconv.ParseInt(freq_param, 10, 64)
+		if err != nil {
+			return w, errors.New("freq parameter must be an integer")
+		} else if freq64 != 10 && freq64 != 1 {
+			return w, errors.New("freq parameter can only be 10 or 1")
+		}
+
+		w.freq = int(freq64)
+	} else {
+		w.freq = 1
+	}
+
+	// resampling by time replaces sampling by frame index when a period is given
+	if period_param := c.Query("period"); period_param != "" {
+		w.period, err = strconv.ParseInt(period_param, 10, 64)
+		if err != nil || w.period <= 0 {
+			return w, errors.New("period parameter must be a positive number of milliseconds")
+		} else if freq_param != "" {
+			return w, errors.New("only one of the freq and period parameters can be given")
+		}
+
+		w.resampler, err = orderbook.NewResampler(int64(w.start), w.period, c.DefaultQuery("resample", orderbook.RESAMPLE_LAST))
+		if err != nil {
+			return w, err
+		}
+
+		w.freq = 10
+	}
+
+	return w, nil
+}
+
+// span returns the length of the window in ms, scaled up for periods under the
+// 100ms between frames since those repeat frames.
+func (w window) span() int {
+	if w.period > 0 && w.period < 100 {
+		return (w.end - w.start) * 100 / int(w.period)
+	}
+
+	return w.end - w.start
+}
+
+// selectBooks selects the frames of the window cut to depth levels per side.
+func (w window) selectBooks(depth int) ([]orderbook.OrderBookSmall, error) {
+	orderbooks, err := w.cache.Select(w.start, w.end, depth, w.freq)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.resampler != nil {
+		orderbooks = append(w.resampler.Add(orderbooks), w.resampler.Flush(int64(w.end))...)
+	}
+
+	return orderbooks, nil
+}
+
+func parseDepth(c *gin.Context, def int) (int, error) {
+	depth_param := c.Query("depth")
+	if depth_param == "" {
+		return def, nil
+	}
+
+	depth64, err := strconv.ParseInt(depth_param, 10, 64)
+	if err != nil {
+		return 0, errors.New("depth parameter must be an integer")
+	} else if depth64 > orderbook.MAX_DEPTH || depth64 < 0 {
+		return 0, errors.New("depth parameter must be between 0 and 5000")
+	}
+
+	return int(depth64), nil
+}
+
+// parseStreamWindow parses the symbol, start and end of endpoints which stream
+// histories from the store rather than selecting them through the cache. The
+// window can be at most max ms long.
+func parseStreamWindow(c *gin.Context, max int) (string, int64, int64, error) {
+	symbol := c.Query("symbol")
+	if symbol == "" {
+		return "", 0, 0, errors.New("query parameter 'symbol' required")
+	}
+
+	if _, ok := symbolCache[symbol]; !ok {
+		return "", 0, 0, errors.New("symbol not found")
+	}
+
+	start_param, end_param := c.Query("start"), c.Query("end")
+	if start_param == "" || end_param == "" {
+		return "", 0, 0, errors.New("query parameters 'start' and 'end' required")
+	}
+
+	start, err := utils.DateTimeStringToUnixMilli(start_param)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	end, err := utils.DateTimeStringToUnixMilli(end_param)
+	if err != nil {
+		return "", 0, 0, err
+	} else if end < start {
+		return "", 0, 0, errors.New("query parameter 'end' must be before query parameter 'start'")
+	} else if end-start > max {
+		return "", 0, 0, fmt.Errorf("requested window is too big! Maximum window is %d ms long", max)
+	}
+
+	return symbol, int64(start), int64(end), nil
+}
@@ -1,84 +1,89 @@
 package binance
 
 import (
-	"io"
-	"log"
-	"net/http"
-	"sync/atomic"
+	"errors"
+	"sync"
 	"time"
+
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
 )
 
 const (
-	API_WEIGHT_LIMIT    = 1200
-	API_REQUEST_TIMEOUT = time.Minute
-
-	CONNECTION_LIMIT        = 300
+	CONNECTION_LIMIT        = 300 // connections of a client, each with up to Market.StreamLimit streams
 	MAKE_CONNECTION_LIMIT   = 300
 	MAKE_CONNECTION_TIMEOUT = 5 * time.Minute
 )
 
 type BinanceClient struct {
-	api_weight int32
-	api_timer  chan struct{}
+	market Market
+	limits exchange.Limits
+	scales *exchange.Scales
+	pool   *connectionPool
+}
 
-	connections []Connection
+// connectionPool holds the connections streams of a client are multiplexed
+// over.
+type connectionPool struct {
+	mu          sync.Mutex
+	connections []*Connection
 }
 
+// NewClient returns a client of the spot market.
 func NewClient() BinanceClient {
+	return NewMarketClient(SPOT)
+}
+
+func NewMarketClient(market Market) BinanceClient {
 	return BinanceClient{
-		api_weight: API_WEIGHT_LIMIT,
-		api_timer:  make(chan struct{}),
+		market: market,
+		limits: exchange.Limits{
+			Requests:    exchange.NewLimiter(market.WeightLimit, market.WeightPeriod),
+			Connections: exchange.NewLimiter(MAKE_CONNECTION_LIMIT, MAKE_CONNECTION_TIMEOUT),
+		},
+		scales: &exchange.Scales{},
+		pool:   &connectionPool{},
 	}
 }
 
-func (client *BinanceClient) makeAPIRequest(endpoint string, weight int32) []byte {
-	for weight > atomic.LoadInt32(&client.api_weight) {
-		<-client.api_timer
-	}
+// getJSON decodes the response of a REST request to the api of the market.
+func (client *BinanceClient) getJSON(endpoint string, weight int32, v interface{}) error {
+	return exchange.GetJSON(client.market.API+endpoint, weight, client.limits, v)
+}
 
-	atomic.AddInt32(&client.api_weight, -weight)
-	go func() {
-		<-time.NewTimer(API_REQUEST_TIMEOUT).C
-		client.api_timer <- struct{}{}
-		atomic.AddInt32(&client.api_weight, weight)
-	}()
+// subscribeStream subscribes a stream on the first connection with room for
+// it, opening a new connection if none has.
+func (client *BinanceClient) subscribeStream(streamName string, handler handlerFunc) (*Connection, error) {
+	pool := client.pool
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
 
-	resp, err := http.Get("https://api.binance.com/api/" + endpoint)
-	if err != nil {
-		log.Fatal("Error: ", err)
+	open := pool.connections[:0]
+	for _, connection := range pool.connections {
+		if !connection.isClosed() {
+			open = append(open, connection)
+		}
 	}
-	defer resp.Body.Close()
+	pool.connections = open
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal("Error: ", err)
+	for _, connection := range pool.connections {
+		if connection.SubscribeStream(streamName, handler) {
+			return connection, nil
+		}
 	}
 
-	return bodyBytes
-}
-
-func (client *BinanceClient) subscribeStream(streamName string, handler handlerFunc) {
-	if client.connections == nil {
-		client.connections = make([]Connection, 1)
+	if len(pool.connections) == CONNECTION_LIMIT {
+		return nil, errors.New("connection limit reached")
+	}
 
-		client.connections[0] = NewConnection()
-		client.connections[0].StartReader()
-	} else if len(client.connections) == CONNECTION_LIMIT {
-		log.Fatal("Connection Limit Reached!")
+	client.limits.Connections.Wait(1)
+	connection, err := NewConnection(client.market)
+	if err != nil {
+		return nil, err
 	}
 
-	for i := range client.connections {
-		res := client.connections[i].SubscribeStream(streamName, handler)
-		if res {
-			break
-		} else if i == len(client.connections)-1 {
-			client.connections = append(
-				client.connections,
-				NewConnection(),
-			)
+	connection.StartReader()
+	connection.SubscribeStream(streamName, handler)
+	pool.connections = append(pool.connections, connection)
 
-			client.connections[i+1].StartReader()
-			client.connections[i+1].SubscribeStream(streamName, handler)
-		}
-	}
+	return connection, nil
 }
@@ -1,88 +1,281 @@
 package binance
 
-
 import (
+	"encoding/json"
 	"log"
+	"sync"
 	"sync/atomic"
 	"time"
-	
+
 	"github.com/gorilla/websocket"
 )
 
+// A Connection multiplexes the streams of many symbols over one websocket to
+// the combined stream endpoint, which wraps every message with the name of
+// its stream. Streams are added and removed with SUBSCRIBE and UNSUBSCRIBE
+// messages, binance limits the messages a connection sends per second, so
+// requests are queued and sent in batches by a writer.
 
 const (
-	STREAM_LIMIT = 1024
-
-	CONNECTION_REQUEST_LIMIT = 5
 	CONNECTION_REQUEST_TIMEOUT = time.Second
-)
 
+	// binance closes connections after 24 hours, streams are moved to a new
+	// connection before that, see depthSubscription
+	CONNECTION_ROTATE_AGE = 23*time.Hour + 30*time.Minute
+)
 
 var messageId int32 = 0
 
-
+// handlerFunc is called with every message of a stream, and with nil once if
+// the connection closes.
 type handlerFunc func([]byte)
 
 type Connection struct {
 	conn *websocket.Conn
-	streams int32
-	requests int32
-	timer chan struct{}
+
+	streamLimit   int
+	requestPeriod time.Duration
+
+	mu       sync.Mutex
+	handlers map[string]handlerFunc
+	requests map[string]bool // pending subscribes (true) and unsubscribes (false)
+	retired  bool
+	closed   bool
+
+	// retire is closed once the connection takes no new streams, done once
+	// it is closed
+	retire chan struct{}
+	done   chan struct{}
 }
 
 type Message struct {
-	Method string `json:"method"`
+	Method string   `json:"method"`
 	Params []string `json:"params"`
-	Id int32 `json:"id"`
+	Id     int32    `json:"id"`
 }
 
+// streamMessage is a message of a combined stream, or the response to a
+// request if Stream is empty.
+type streamMessage struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+
+	Id    int32 `json:"id"`
+	Error *struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	} `json:"error"`
+}
 
 func getNextMessageId() int32 {
-	atomic.AddInt32(&messageId, 1)
-	return atomic.LoadInt32(&messageId)
+	return atomic.AddInt32(&messageId, 1)
 }
 
-func NewConnection() Connection {
-	conn, _, err := websocket.DefaultDialer.Dial("wss://stream.binance.com:9443/ws/", nil)
+func NewConnection(market Market) (*Connection, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(market.Stream, nil)
 	if err != nil {
-		log.Fatal("Encountered Error: ", err)
+		return nil, err
 	}
 
-	return Connection{
-		conn: conn,
-		streams: 0,
-		requests: 0,
-		timer: make(chan struct{}),
+	connection := &Connection{
+		conn:        conn,
+		streamLimit: market.StreamLimit,
+		// pongs to the pings of binance count towards the limit as well, so
+		// one message per second is left for them
+		requestPeriod: CONNECTION_REQUEST_TIMEOUT / time.Duration(market.MessageLimit-1),
+		handlers:      make(map[string]handlerFunc),
+		requests:      make(map[string]bool),
+		retire:        make(chan struct{}),
+		done:          make(chan struct{}),
 	}
+
+	time.AfterFunc(CONNECTION_ROTATE_AGE, connection.Retire)
+
+	return connection, nil
 }
 
+// StartReader starts routing messages to the handlers of their streams and
+// sending queued requests.
 func (connection *Connection) StartReader() {
+	go connection.write()
+
 	go func() {
-		for {}
+		for {
+			_, message, err := connection.conn.ReadMessage()
+			if err != nil {
+				log.Printf("Combined stream connection failed: %s \n", err)
+				connection.fail()
+				return
+			}
+
+			var msg streamMessage
+			if err := json.Unmarshal(message, &msg); err != nil {
+				log.Printf("Failed to decode combined stream message: %s \n", err)
+				continue
+			}
+
+			if msg.Stream == "" {
+				if msg.Error != nil {
+					log.Printf("Stream request %d failed: %s \n", msg.Id, msg.Error.Msg)
+				}
+				continue
+			}
+
+			connection.mu.Lock()
+			handler, ok := connection.handlers[msg.Stream]
+			connection.mu.Unlock()
+
+			if ok {
+				handler(msg.Data)
+			}
+		}
 	}()
 }
 
+// fail closes the connection after it failed and tells every handler.
+func (connection *Connection) fail() {
+	connection.mu.Lock()
+	handlers := connection.handlers
+	connection.handlers = make(map[string]handlerFunc)
+	connection.closed = true
+	close(connection.done)
+	connection.mu.Unlock()
+
+	connection.conn.Close()
+
+	for _, handler := range handlers {
+		handler(nil)
+	}
+}
+
+// write sends at most one request per requestPeriod, subscribing or
+// unsubscribing every stream queued since the last.
+func (connection *Connection) write() {
+	ticker := time.NewTicker(connection.requestPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-connection.done:
+			return
+		case <-ticker.C:
+		}
+
+		msg, ok := connection.nextRequest()
+		if !ok {
+			continue
+		}
+
+		if err := connection.conn.WriteJSON(msg); err != nil {
+			log.Printf("Failed to send %s of %d streams: %s \n", msg.Method, len(msg.Params), err)
+			connection.Close()
+			return
+		}
+	}
+}
+
+func (connection *Connection) nextRequest() (Message, bool) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+
+	msg := Message{Method: "SUBSCRIBE", Params: make([]string, 0)}
+	for streamName, subscribe := range connection.requests {
+		if subscribe {
+			msg.Params = append(msg.Params, streamName)
+		}
+	}
+
+	if len(msg.Params) == 0 {
+		msg.Method = "UNSUBSCRIBE"
+		for streamName := range connection.requests {
+			msg.Params = append(msg.Params, streamName)
+		}
+	}
+
+	if len(msg.Params) == 0 {
+		return msg, false
+	}
+
+	for _, streamName := range msg.Params {
+		delete(connection.requests, streamName)
+	}
+	msg.Id = getNextMessageId()
+
+	return msg, true
+}
+
+// request queues a subscribe or unsubscribe, cancelling a queued request of
+// the opposite kind.
+func (connection *Connection) request(streamName string, subscribe bool) {
+	if pending, ok := connection.requests[streamName]; ok && pending != subscribe {
+		delete(connection.requests, streamName)
+		return
+	}
+
+	connection.requests[streamName] = subscribe
+}
+
 func (connection *Connection) Close() {
 	connection.conn.Close()
 }
 
+// Retire stops the connection from taking new streams, it is closed once its
+// last stream is unsubscribed.
+func (connection *Connection) Retire() {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+
+	if connection.retired {
+		return
+	}
+
+	connection.retired = true
+	close(connection.retire)
+
+	if len(connection.handlers) == 0 {
+		connection.Close()
+	}
+}
+
+// SubscribeStream adds a stream to the connection, returning false if the
+// connection takes no more streams or already has this one.
 func (connection *Connection) SubscribeStream(streamName string, handler handlerFunc) bool {
-	if atomic.LoadInt32(&connection.streams) == STREAM_LIMIT {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+
+	if connection.closed || connection.retired || len(connection.handlers) >= connection.streamLimit {
 		return false
-	} else {
-		atomic.AddInt32(&connection.streams, 1)
 	}
 
-	atomic.AddInt32(&connection.requests, 1)
-	go func() {
-		<-time.NewTimer(CONNECTION_REQUEST_TIMEOUT).C
-		atomic.AddInt32(&connection.requests, -1)
-	}()
-
-	err := connection.conn.WriteJSON(Message{Method: "SUBSCRIBE", Params: []string{streamName}, Id: getNextMessageId()})
-	if err != nil {
-		log.Fatal(err)
+	if _, ok := connection.handlers[streamName]; ok {
+		return false
 	}
 
+	connection.handlers[streamName] = handler
+	connection.request(streamName, true)
+
 	return true
 }
+
+func (connection *Connection) UnsubscribeStream(streamName string) {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+
+	if _, ok := connection.handlers[streamName]; !ok {
+		return
+	}
+
+	delete(connection.handlers, streamName)
+	connection.request(streamName, false)
+
+	if connection.retired && len(connection.handlers) == 0 {
+		connection.Close()
+	}
+}
+
+func (connection *Connection) isClosed() bool {
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+
+	return connection.closed
+}
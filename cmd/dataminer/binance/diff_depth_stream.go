@@ -2,15 +2,18 @@ package binance
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
-
-	"github.com/gorilla/websocket"
+	"sync"
+	"time"
 
 	"github.com/crypto_pickle/internal/orderbook"
-	"github.com/crypto_pickle/internal/utils"
 )
 
+// MAX_QUEUED_DIFFS caps the diffs queued for a caller that doesn't keep up,
+// past it the subscription is closed like a failed connection. At 10 diffs a
+// second that is almost 2 minutes.
+const MAX_QUEUED_DIFFS = 1000
+
 type RawDepthDiff struct {
 	EventType     string     `json:"e"`
 	EventTime     int64      `json:"E"`
@@ -19,64 +22,326 @@ type RawDepthDiff struct {
 	LastUpdateId  int64      `json:"u"`
 	Bids          [][]string `json:"b"`
 	Asks          [][]string `json:"a"`
+
+	// PrevLastUpdateId is the LastUpdateId of the previous diff of the stream,
+	// only sent by futures streams.
+	PrevLastUpdateId int64 `json:"pu"`
+
+	// ReceiveTime is the local time in ms the diff was read from the stream.
+	ReceiveTime int64 `json:"-"`
 }
 
-func (rawDiff RawDepthDiff) ToDepthDiff() orderbook.DepthDiff {
+// ToDepthDiff converts a diff of a stream. The U of a futures diff isn't one
+// past the u of the previous diff, whether it continues the stream is told by
+// its pu instead.
+func (rawDiff RawDepthDiff) ToDepthDiff(scale orderbook.Scale) (orderbook.DepthDiff, error) {
 	newDiff := orderbook.DepthDiff{
-		Time: rawDiff.EventTime,
-		Bids: make(orderbook.DepthLevel),
-		Asks: make(orderbook.DepthLevel),
+		Time:          rawDiff.EventTime,
+		FirstUpdateId: rawDiff.FirstUpdateId,
+		LastUpdateId:  rawDiff.LastUpdateId,
+		ReceiveTime:   rawDiff.ReceiveTime,
+		Bids:          make(orderbook.DepthLevel),
+		Asks:          make(orderbook.DepthLevel),
 	}
 
-	for _, bid := range rawDiff.Bids {
-		newDiff.Bids[utils.StringToFloat(bid[0])] = utils.StringToFloat(bid[1])
+	if err := setLevels(newDiff.Bids, scale, rawDiff.Bids); err != nil {
+		return orderbook.DepthDiff{}, err
 	}
 
-	for _, ask := range rawDiff.Asks {
-		newDiff.Asks[utils.StringToFloat(ask[0])] = utils.StringToFloat(ask[1])
+	if err := setLevels(newDiff.Asks, scale, rawDiff.Asks); err != nil {
+		return orderbook.DepthDiff{}, err
 	}
 
-	return newDiff
+	return newDiff, nil
 }
 
-func FromJsonBytes(bytes []byte) *RawDepthDiff {
-	rawDiff := new(RawDepthDiff)
-	err := json.Unmarshal(bytes, &rawDiff)
-	if err != nil {
-		log.Fatal("Error: ", err)
+// SubscribeDepthDiffStream streams the diffs of symbol until done is closed.
+// The stream is closed if the connection fails, so the caller can reconnect.
+func (client *BinanceClient) SubscribeDepthDiffStream(symbol string) (chan RawDepthDiff, chan struct{}, error) {
+	sub := &depthSubscription{
+		client: client,
+		stream: symbol + "@depth@100ms",
+		diffs:  make(chan RawDepthDiff, 10),
+		done:   make(chan struct{}),
+		end:    make(chan struct{}),
+		queued: make(chan struct{}, 1),
+		active: &streamRef{},
 	}
 
-	return rawDiff
+	if err := sub.subscribe(sub.active); err != nil {
+		return nil, nil, err
+	}
+
+	go sub.forward()
+	go sub.run()
+
+	return sub.diffs, sub.done, nil
 }
 
-func (client *BinanceClient) SubscribeDepthDiffStream(symbol string) (chan RawDepthDiff, chan struct{}) {
-	diffStream, done := make(chan RawDepthDiff, 10), make(chan struct{})
+// depthSubscription feeds the diffs of a stream on the shared connections
+// into a channel. When its connection retires before binance closes it, the
+// stream is subscribed on a new connection and the diffs of the new one are
+// held back until the old connection caught up with them, so no diff is lost
+// in between.
+//
+// The handlers run on the readers of the connections, which are shared by
+// every stream of the client. They never wait for the caller, diffs are
+// queued and forwarded to the channel by a goroutine of the subscription, up
+// to MAX_QUEUED_DIFFS.
+type depthSubscription struct {
+	client *BinanceClient
+	stream string
+	diffs  chan RawDepthDiff
+	done   chan struct{}
 
-	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("wss://stream.binance.com:9443/ws/%s@depth@100ms", symbol), nil)
+	// end is closed once the subscription closed, diffs after the queue
+	// is forwarded
+	end chan struct{}
+
+	queue  []RawDepthDiff
+	queued chan struct{} // signals forward that the queue changed
+
+	mu           sync.Mutex
+	active, next *streamRef
+	pending      []RawDepthDiff // diffs of next while the subscription moves
+	switched     chan struct{}  // closed once the subscription moved to next
+	lastUpdateId int64
+	closed       bool
+}
+
+// streamRef is one subscription of the stream on a connection.
+type streamRef struct {
+	connection *Connection
+}
+
+// subscribe subscribes the stream for ref. Connecting can take a while, so
+// the lock isn't held meanwhile and the handlers of the stream on other
+// connections keep running.
+func (sub *depthSubscription) subscribe(ref *streamRef) error {
+	connection, err := sub.client.subscribeStream(sub.stream, func(message []byte) {
+		sub.handle(ref, message)
+	})
 	if err != nil {
-		log.Fatal("Encountered Error: ", err)
+		return err
 	}
 
-	go func() {
-		defer conn.Close()
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
 
-		for {
-			select {
-			case <-done:
-				close(diffStream)
-				close(done)
+	ref.connection = connection
+	if sub.closed {
+		connection.UnsubscribeStream(sub.stream)
+	}
 
+	return nil
+}
+
+func (sub *depthSubscription) run() {
+	for {
+		sub.mu.Lock()
+		retire := sub.active.connection.retire
+		sub.mu.Unlock()
+
+		select {
+		case <-sub.done:
+			sub.close()
+			return
+		case <-sub.end:
+			return
+		case <-retire:
+			if !sub.move() {
 				return
-			default:
-				_, message, err := conn.ReadMessage()
-				if err != nil {
-					log.Fatal()
-				}
+			}
+		}
+	}
+}
+
+// move subscribes the stream on a new connection and waits until the diffs
+// are read from it.
+func (sub *depthSubscription) move() bool {
+	next := &streamRef{}
+
+	sub.mu.Lock()
+	sub.next, sub.pending, sub.switched = next, nil, make(chan struct{})
+	switched := sub.switched
+	sub.mu.Unlock()
+
+	if err := sub.subscribe(next); err != nil {
+		log.Printf("Failed to move %s to a new connection: %s \n", sub.stream, err)
+
+		// the stream stays on the retired connection until it is closed
+		sub.mu.Lock()
+		sub.next = nil
+		sub.mu.Unlock()
+	}
+
+	select {
+	case <-sub.done:
+		sub.close()
+		return false
+	case <-sub.end:
+		return false
+	case <-switched:
+		return true
+	}
+}
+
+func (sub *depthSubscription) handle(ref *streamRef, message []byte) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	if message == nil {
+		switch ref {
+		case sub.next:
+			log.Printf("Connection of %s failed while moving to it \n", sub.stream)
+			sub.next, sub.pending = nil, nil
+		case sub.active:
+			// the diffs of next may not continue the old connection, which
+			// the caller sees in their update ids
+			if sub.next != nil {
+				sub.switchToNext()
+			} else {
+				sub.closeLocked()
+			}
+		}
+
+		return
+	}
+
+	rawDiff := new(RawDepthDiff)
+	if err := json.Unmarshal(message, rawDiff); err != nil {
+		log.Printf("Failed to decode diff of %s: %s \n", sub.stream, err)
+		return
+	}
+	rawDiff.ReceiveTime = time.Now().UnixMilli()
+
+	switch ref {
+	case sub.active:
+		sub.send(*rawDiff)
+	case sub.next:
+		sub.pending = append(sub.pending, *rawDiff)
+	default:
+		return
+	}
 
-				diffStream <- *FromJsonBytes(message)
+	if !sub.closed && sub.next != nil && sub.continued() {
+		sub.switchToNext()
+	}
+}
+
+// send queues a diff for the caller, closing the subscription if the queue is
+// full. The caller gets the diffs queued so far and resubscribes.
+func (sub *depthSubscription) send(rawDiff RawDepthDiff) {
+	if sub.closed {
+		return
+	}
+
+	if len(sub.queue) >= MAX_QUEUED_DIFFS {
+		log.Printf("Diffs of %s aren't read, closing the stream \n", sub.stream)
+		sub.closeLocked()
+		return
+	}
+
+	sub.queue = append(sub.queue, rawDiff)
+	sub.lastUpdateId = rawDiff.LastUpdateId
+	sub.notify()
+}
+
+func (sub *depthSubscription) notify() {
+	select {
+	case sub.queued <- struct{}{}:
+	default:
+	}
+}
+
+// forward sends the queued diffs to the caller until the subscription closed
+// and its queue is empty, or the caller is done.
+func (sub *depthSubscription) forward() {
+	defer close(sub.diffs)
+
+	for {
+		sub.mu.Lock()
+		queue, closed := sub.queue, sub.closed
+		sub.queue = nil
+		sub.mu.Unlock()
+
+		for _, rawDiff := range queue {
+			select {
+			case sub.diffs <- rawDiff:
+			case <-sub.done:
+				return
 			}
 		}
-	}()
 
-	return diffStream, done
+		if closed {
+			return
+		}
+
+		select {
+		case <-sub.queued:
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+// continued reports whether the diffs of next continue the diffs sent so far.
+func (sub *depthSubscription) continued() bool {
+	for len(sub.pending) > 0 && sub.pending[0].LastUpdateId <= sub.lastUpdateId {
+		sub.pending = sub.pending[1:]
+	}
+
+	if len(sub.pending) == 0 {
+		return false
+	}
+
+	if sub.client.market.Futures {
+		return sub.pending[0].PrevLastUpdateId <= sub.lastUpdateId
+	}
+
+	return sub.pending[0].FirstUpdateId <= sub.lastUpdateId+1
+}
+
+func (sub *depthSubscription) switchToNext() {
+	old := sub.active
+	sub.active, sub.next = sub.next, nil
+
+	pending := sub.pending
+	sub.pending = nil
+
+	for _, rawDiff := range pending {
+		if rawDiff.LastUpdateId > sub.lastUpdateId {
+			sub.send(rawDiff)
+		}
+	}
+
+	old.connection.UnsubscribeStream(sub.stream)
+	close(sub.switched)
+
+	log.Printf("Moved %s to a new connection \n", sub.stream)
+}
+
+func (sub *depthSubscription) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if !sub.closed {
+		sub.closeLocked()
+	}
+}
+
+func (sub *depthSubscription) closeLocked() {
+	sub.closed = true
+	close(sub.end)
+	sub.notify()
+
+	for _, ref := range []*streamRef{sub.active, sub.next} {
+		if ref != nil && ref.connection != nil {
+			ref.connection.UnsubscribeStream(sub.stream)
+		}
+	}
 }
@@ -0,0 +1,200 @@
+package binance
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testConnection returns a connection without a websocket, the test calls the
+// handlers of its streams.
+func testConnection() *Connection {
+	return &Connection{
+		streamLimit: 10,
+		handlers:    make(map[string]handlerFunc),
+		requests:    make(map[string]bool),
+		retire:      make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// handler waits for the handler of stream on connection.
+func handler(t *testing.T, connection *Connection, stream string) handlerFunc {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		connection.mu.Lock()
+		handler, ok := connection.handlers[stream]
+		connection.mu.Unlock()
+
+		if ok {
+			return handler
+		}
+	}
+
+	t.Fatalf("%s isn't subscribed", stream)
+	return nil
+}
+
+func diffMessage(first, last, prev int64) []byte {
+	return []byte(fmt.Sprintf(`{"e":"depthUpdate","U":%d,"u":%d,"pu":%d,"b":[],"a":[]}`, first, last, prev))
+}
+
+// received reads the diffs of a stream until it is closed.
+func received(t *testing.T, diffs chan RawDepthDiff) []int64 {
+	res := make([]int64, 0)
+	for {
+		select {
+		case rawDiff, ok := <-diffs:
+			if !ok {
+				return res
+			}
+			res = append(res, rawDiff.LastUpdateId)
+		case <-time.After(time.Second):
+			t.Fatal("stream isn't closed")
+		}
+	}
+}
+
+type streamStep struct {
+	on                string // old or new connection
+	first, last, prev int64
+	fail              bool // the connection closes
+}
+
+func TestMoveSubscription(t *testing.T) {
+	tests := []struct {
+		name    string
+		futures bool
+
+		// diffs of the old connection before it retires, then steps while
+		// the stream moves
+		before []streamStep
+		steps  []streamStep
+		want   []int64
+	}{
+		{
+			name:   "new connection behind the old",
+			before: []streamStep{{on: "old", first: 1, last: 1}, {on: "old", first: 2, last: 2}},
+			steps: []streamStep{
+				{on: "new", first: 2, last: 2}, {on: "old", first: 3, last: 3}, {on: "old", first: 4, last: 4},
+				{on: "new", first: 3, last: 3}, {on: "new", first: 4, last: 4}, {on: "new", first: 5, last: 5},
+				{on: "old", first: 5, last: 5}, {on: "new", first: 6, last: 6},
+			},
+			want: []int64{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:   "new connection ahead of the old",
+			before: []streamStep{{on: "old", first: 1, last: 1}, {on: "old", first: 2, last: 2}},
+			steps: []streamStep{
+				{on: "new", first: 5, last: 5}, {on: "new", first: 6, last: 6}, {on: "old", first: 3, last: 3},
+				{on: "old", first: 4, last: 4}, {on: "old", first: 5, last: 5}, {on: "new", first: 7, last: 7},
+			},
+			want: []int64{1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:   "new connection fails while moving",
+			before: []streamStep{{on: "old", first: 1, last: 1}, {on: "old", first: 2, last: 2}},
+			steps: []streamStep{
+				{on: "new", first: 5, last: 5}, {on: "new", fail: true}, {on: "old", first: 3, last: 3},
+				{on: "old", first: 4, last: 4}, {on: "old", first: 5, last: 5}, {on: "old", first: 6, last: 6},
+			},
+			want: []int64{1, 2, 3, 4, 5, 6},
+		},
+		{
+			// the caller sees the gap in the update ids and resyncs
+			name:   "old connection fails while moving",
+			before: []streamStep{{on: "old", first: 1, last: 1}, {on: "old", first: 2, last: 2}},
+			steps: []streamStep{
+				{on: "new", first: 5, last: 5}, {on: "new", first: 6, last: 6}, {on: "old", first: 3, last: 3},
+				{on: "old", fail: true}, {on: "new", first: 7, last: 7},
+			},
+			want: []int64{1, 2, 3, 5, 6, 7},
+		},
+		{
+			name:    "futures continue on pu",
+			futures: true,
+			before:  []streamStep{{on: "old", first: 1, last: 10}, {on: "old", first: 11, last: 20, prev: 10}},
+			steps: []streamStep{
+				{on: "new", first: 15, last: 20, prev: 12}, {on: "new", first: 31, last: 40, prev: 30},
+				{on: "old", first: 21, last: 30, prev: 20}, {on: "old", first: 31, last: 40, prev: 30},
+				{on: "new", first: 41, last: 50, prev: 40},
+			},
+			want: []int64{10, 20, 30, 40, 50},
+		},
+	}
+
+	for _, test := range tests {
+		old, next := testConnection(), testConnection()
+		client := &BinanceClient{market: Market{Futures: test.futures}, pool: &connectionPool{connections: []*Connection{old, next}}}
+
+		diffs, done, err := client.SubscribeDepthDiffStream("btcusdt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream := "btcusdt@depth@100ms"
+
+		handlers := map[string]handlerFunc{"old": handler(t, old, stream)}
+		for _, step := range test.before {
+			handlers[step.on](diffMessage(step.first, step.last, step.prev))
+		}
+
+		// retire the old connection without closing it, which would close
+		// its websocket
+		close(old.retire)
+		handlers["new"] = handler(t, next, stream)
+
+		for _, step := range test.steps {
+			if step.fail {
+				handlers[step.on](nil)
+				continue
+			}
+			handlers[step.on](diffMessage(step.first, step.last, step.prev))
+		}
+
+		handlers["new"](nil)
+		handlers["old"](nil)
+
+		if got := received(t, diffs); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, got, test.want)
+		}
+		close(done)
+	}
+}
+
+func TestQueueLimit(t *testing.T) {
+	connection := testConnection()
+	client := &BinanceClient{pool: &connectionPool{connections: []*Connection{connection}}}
+
+	diffs, done, err := client.SubscribeDepthDiffStream("btcusdt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close(done)
+
+	stream := "btcusdt@depth@100ms"
+	handler := handler(t, connection, stream)
+
+	// the forwarder holds one batch of at most MAX_QUEUED_DIFFS and the
+	// channel its buffer, the rest overflows the queue
+	sent := int64(2*MAX_QUEUED_DIFFS + cap(diffs) + 1)
+	for id := int64(1); id <= sent; id++ {
+		handler(diffMessage(id, id, 0))
+	}
+
+	got := received(t, diffs)
+	if int64(len(got)) >= sent {
+		t.Fatalf("all %d diffs queued", sent)
+	}
+
+	for i, id := range got {
+		if id != int64(i+1) {
+			t.Fatalf("diff %d is %d", i, id)
+		}
+	}
+
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+	if len(connection.handlers) != 0 {
+		t.Error("stream still subscribed")
+	}
+}
@@ -0,0 +1,157 @@
+package binance
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// BinanceClient implements exchange.Exchange for a binance market. Symbols
+// are written as in the binance api, e.g. btcusdt, and spot symbols are stored
+// without an exchange prefix since binance was mined before any other
+// exchange.
+//
+// Futures are stored under their market, pair and contract instead, e.g.
+// binance-usdm-btcusdt-perp for the USD-M perpetual or
+// binance-coinm-btcusd-250627 for a COIN-M quarterly, so they are separate
+// symbols next to spot. COIN-M pairs are quoted in USD and USD-M pairs never
+// are, so the pair tells the markets apart. In the config the
+// perpetual of a pair can be written as just the pair, e.g.
+// binance-coinm:btcusd for BTCUSD_PERP.
+
+func (client *BinanceClient) Name() string {
+	return client.market.Name
+}
+
+func (client *BinanceClient) NormalizeSymbol(symbol string) string {
+	if !client.market.Futures {
+		return strings.ToUpper(strings.Replace(symbol, "-", "", 1))
+	}
+
+	pair, contract, ok := strings.Cut(strings.ToUpper(symbol), "-")
+	if !ok || contract == "PERP" {
+		return pair + client.market.perpetualSuffix
+	}
+
+	return pair + "_" + contract
+}
+
+func (client *BinanceClient) StorageSymbol(symbol string) string {
+	symbol = strings.ToLower(client.NormalizeSymbol(symbol))
+	if !client.market.Futures {
+		return symbol
+	}
+
+	pair, contract, ok := strings.Cut(symbol, "_")
+	if !ok {
+		contract = "perp"
+	}
+
+	return client.market.Name + "-" + pair + "-" + contract
+}
+
+// checkSymbol rejects futures symbols of the other futures market, e.g.
+// btcusd on USD-M, which NormalizeSymbol would map onto a symbol of neither.
+func (client *BinanceClient) checkSymbol(symbol string) error {
+	if !client.market.Futures {
+		return nil
+	}
+
+	pair, _, _ := strings.Cut(strings.ToUpper(symbol), "-")
+	usdQuoted := strings.HasSuffix(pair, "USD") && !strings.HasSuffix(pair, "BUSD")
+	if usdQuoted != client.market.usdQuoted {
+		return fmt.Errorf("%s is not a symbol of %s, pairs quoted in USD are COIN-M futures", symbol, client.market.Name)
+	}
+
+	return nil
+}
+
+func (client *BinanceClient) Scale(symbol string) (orderbook.Scale, error) {
+	if err := client.checkSymbol(symbol); err != nil {
+		return orderbook.Scale{}, err
+	}
+
+	return client.scales.Get(client.NormalizeSymbol(symbol), client.GetScale)
+}
+
+func (client *BinanceClient) Snapshot(symbol string, depth int32) (orderbook.OrderBook, error) {
+	scale, err := client.Scale(symbol)
+	if err != nil {
+		return orderbook.OrderBook{}, err
+	}
+
+	rawOB, err := client.GetOrderBook(client.NormalizeSymbol(symbol), depth)
+	if err != nil {
+		return orderbook.OrderBook{}, err
+	}
+
+	return rawOB.ToOrderBook(scale)
+}
+
+// Subscribe streams the diffs of a symbol, snapshots come from Snapshot.
+// Snapshots are limited to the depth of the market, futures to 1000 levels.
+// Futures diffs continue the stream if their pu is the u of the diff before.
+//
+// A diff that doesn't fit the scale closes the stream like a failed
+// connection, the diffs after it on a new stream don't continue the book so
+// the miner syncs from a new snapshot. The scale is looked up again for it in
+// case the tick size of the symbol changed.
+func (client *BinanceClient) Subscribe(symbol string, depth int32) (chan exchange.Update, chan struct{}, error) {
+	scale, err := client.Scale(symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	diffStream, stop, err := client.SubscribeDepthDiffStream(strings.ToLower(client.NormalizeSymbol(symbol)))
+	if err != nil {
+		return nil, nil, err
+	}
+	updates := make(chan exchange.Update, 10)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(updates)
+		defer close(stop)
+
+		for {
+			var rawDiff RawDepthDiff
+			var ok bool
+			select {
+			case rawDiff, ok = <-diffStream:
+			case <-done:
+				return
+			}
+
+			if !ok {
+				return
+			}
+
+			diff, err := rawDiff.ToDepthDiff(scale)
+			if err != nil {
+				log.Printf("Failed to parse diff of %s, resubscribing: %s \n", symbol, err)
+				client.scales.Forget(client.NormalizeSymbol(symbol))
+				return
+			}
+
+			update := exchange.Update{Diff: diff}
+			if client.market.Futures {
+				update.PrevUpdateId = rawDiff.PrevLastUpdateId
+			}
+
+			select {
+			case updates <- update:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return updates, done, nil
+}
+
+func (client *BinanceClient) Limits() exchange.Limits {
+	return client.limits
+}
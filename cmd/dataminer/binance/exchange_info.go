@@ -0,0 +1,30 @@
+package binance
+
+import (
+	"fmt"
+
+	"github.com/crypto_pickle/internal/binanceinfo"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// GetScale looks up the scale of a symbol. The futures exchange info can't be
+// filtered by symbol and lists every contract of the market.
+func (client *BinanceClient) GetScale(symbol string) (orderbook.Scale, error) {
+	endpoint := fmt.Sprintf("exchangeInfo?symbol=%s", symbol)
+	if client.market.Futures {
+		endpoint = "exchangeInfo"
+	}
+
+	info := new(binanceinfo.RawExchangeInfo)
+	if err := client.getJSON(endpoint, client.market.exchangeInfoWeight, info); err != nil {
+		return orderbook.Scale{}, err
+	}
+
+	for _, info := range info.Symbols {
+		if info.Symbol == symbol {
+			return info.ToScale(), nil
+		}
+	}
+
+	return orderbook.Scale{}, fmt.Errorf("exchange info of %s has no symbol %s", client.market.Name, symbol)
+}
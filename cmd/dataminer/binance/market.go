@@ -0,0 +1,128 @@
+package binance
+
+import (
+	"time"
+
+	"github.com/crypto_pickle/internal/binanceinfo"
+)
+
+// Market is a binance market with its own api, streams and rate limits. Spot
+// and the USD-M and COIN-M futures share their message formats, futures diffs
+// additionally carry pu, the last update id of the previous diff of the
+// stream.
+type Market struct {
+	// Name is the exchange name of the market in the miner config
+	Name string
+
+	API    string // base url of the REST api including its version
+	Stream string // url of combined streams
+
+	Futures bool
+
+	// StreamLimit is the number of streams a connection can subscribe,
+	// MessageLimit the number of messages a connection can send per second
+	StreamLimit  int
+	MessageLimit int
+
+	// perpetualSuffix follows the pair in the symbol of a perpetual, USD-M
+	// perpetuals are named after just their pair
+	perpetualSuffix string
+
+	// usdQuoted is set for the futures of pairs quoted in USD, the COIN-M
+	// futures. USD-M pairs are quoted in stablecoins instead.
+	usdQuoted bool
+
+	WeightLimit  int32
+	WeightPeriod time.Duration
+
+	// MaxDepth is the largest depth of a REST snapshot, depthLimits the depths
+	// a snapshot can be requested with if not any depth up to MaxDepth
+	MaxDepth    int32
+	depthLimits []int32
+	depthWeight func(limit int32) int32
+
+	exchangeInfoWeight int32
+}
+
+var (
+	SPOT = Market{
+		Name:   "binance",
+		API:    binanceinfo.SPOT_API,
+		Stream: "wss://stream.binance.com:9443/stream",
+
+		StreamLimit:  1024,
+		MessageLimit: 5,
+
+		WeightLimit:  1200,
+		WeightPeriod: time.Minute,
+
+		MaxDepth:    5000,
+		depthWeight: calculateOrderBookWeight,
+
+		exchangeInfoWeight: 20,
+	}
+
+	USDM = Market{
+		Name:    "binance-usdm",
+		API:     "https://fapi.binance.com/fapi/v1/",
+		Stream:  "wss://fstream.binance.com/stream",
+		Futures: true,
+
+		StreamLimit:  200,
+		MessageLimit: 10,
+
+		WeightLimit:  2400,
+		WeightPeriod: time.Minute,
+
+		MaxDepth:    1000,
+		depthLimits: FUTURES_DEPTH_LIMITS,
+		depthWeight: calculateFuturesOrderBookWeight,
+
+		exchangeInfoWeight: 1,
+	}
+
+	COINM = Market{
+		Name:    "binance-coinm",
+		API:     "https://dapi.binance.com/dapi/v1/",
+		Stream:  "wss://dstream.binance.com/stream",
+		Futures: true,
+
+		StreamLimit:  200,
+		MessageLimit: 10,
+
+		perpetualSuffix: "_PERP",
+		usdQuoted:       true,
+
+		WeightLimit:  2400,
+		WeightPeriod: time.Minute,
+
+		MaxDepth:    1000,
+		depthLimits: FUTURES_DEPTH_LIMITS,
+		depthWeight: calculateFuturesOrderBookWeight,
+
+		exchangeInfoWeight: 1,
+	}
+)
+
+var FUTURES_DEPTH_LIMITS = []int32{5, 10, 20, 50, 100, 500, 1000}
+
+// depthLimit returns the largest depth a snapshot of at most depth levels can
+// be requested with.
+func (market Market) depthLimit(depth int32) int32 {
+	if depth > market.MaxDepth {
+		depth = market.MaxDepth
+	}
+
+	if market.depthLimits == nil {
+		return depth
+	}
+
+	limit := market.depthLimits[0]
+	for _, l := range market.depthLimits {
+		if l <= depth {
+			limit = l
+		}
+	}
+
+	return limit
+}
@@ -1,12 +1,10 @@
 package binance
 
 import (
-	"encoding/json"
 	"fmt"
-	"log"
 
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
 	"github.com/crypto_pickle/internal/orderbook"
-	"github.com/crypto_pickle/internal/utils"
 )
 
 type RawOrderBook struct {
@@ -15,22 +13,41 @@ type RawOrderBook struct {
 	Asks         [][]string `json:"asks"`
 }
 
-func (rawOB *RawOrderBook) ToOrderBook() orderbook.OrderBook {
+func (rawOB *RawOrderBook) ToOrderBook(scale orderbook.Scale) (orderbook.OrderBook, error) {
 	newOB := orderbook.OrderBook{
-		Time: 0,
-		Bids: make(orderbook.DepthLevel),
-		Asks: make(orderbook.DepthLevel),
+		Time:     0,
+		UpdateId: rawOB.LastUpdateId,
+		Scale:    scale,
+		Bids:     make(orderbook.DepthLevel),
+		Asks:     make(orderbook.DepthLevel),
 	}
 
-	for _, bid := range rawOB.Bids {
-		newOB.Bids[utils.StringToFloat(bid[0])] = utils.StringToFloat(bid[1])
+	if err := setLevels(newOB.Bids, scale, rawOB.Bids); err != nil {
+		return orderbook.OrderBook{}, err
 	}
 
-	for _, ask := range rawOB.Asks {
-		newOB.Asks[utils.StringToFloat(ask[0])] = utils.StringToFloat(ask[1])
+	if err := setLevels(newOB.Asks, scale, rawOB.Asks); err != nil {
+		return orderbook.OrderBook{}, err
 	}
 
-	return newOB
+	return newOB, nil
+}
+
+// setLevels parses levels as sent by binance, [price, quantity], into dl.
+// A price or quantity finer than the scale is an error, e.g. after the tick
+// size of the symbol changed.
+func setLevels(dl orderbook.DepthLevel, scale orderbook.Scale, levels [][]string) error {
+	for _, level := range levels {
+		if len(level) < 2 {
+			return fmt.Errorf("invalid binance level %v", level)
+		}
+
+		if err := exchange.SetLevel(dl, scale, level[0], level[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func calculateOrderBookWeight(limit int32) int32 {
@@ -45,15 +62,29 @@ func calculateOrderBookWeight(limit int32) int32 {
 	}
 }
 
-func (client *BinanceClient) GetOrderBook(symbol string, limit int32) *RawOrderBook {
-	endpoint := fmt.Sprintf("v3/depth?symbol=%s&limit=%d", symbol, limit)
-	bytes := client.makeAPIRequest(endpoint, calculateOrderBookWeight(limit))
+func calculateFuturesOrderBookWeight(limit int32) int32 {
+	if limit > 500 {
+		return 20
+	} else if limit > 100 {
+		return 10
+	} else if limit > 50 {
+		return 5
+	} else {
+		return 2
+	}
+}
+
+// GetOrderBook fetches a snapshot of up to limit levels per side, limited to
+// the depths the market offers.
+func (client *BinanceClient) GetOrderBook(symbol string, limit int32) (*RawOrderBook, error) {
+	limit = client.market.depthLimit(limit)
+
+	endpoint := fmt.Sprintf("depth?symbol=%s&limit=%d", symbol, limit)
 
 	rawOB := new(RawOrderBook)
-	err := json.Unmarshal(bytes, &rawOB)
-	if err != nil {
-		log.Fatal("Error: ", err)
+	if err := client.getJSON(endpoint, client.market.depthWeight(limit), rawOB); err != nil {
+		return nil, err
 	}
 
-	return rawOB
+	return rawOB, nil
 }
@@ -0,0 +1,67 @@
+package binance
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+var SCALE = orderbook.Scale{PriceDecimals: 2, QtyDecimals: 5}
+
+func TestToDepthDiff(t *testing.T) {
+	rawDiff := RawDepthDiff{
+		EventTime:     1700000000000,
+		FirstUpdateId: 157,
+		LastUpdateId:  160,
+		Bids:          [][]string{{"0.0024", "10"}},
+		Asks:          [][]string{{"0.0026", "100"}},
+		ReceiveTime:   1700000000012,
+	}
+
+	// finer than the scale, e.g. after the tick size changed
+	if _, err := rawDiff.ToDepthDiff(SCALE); err == nil {
+		t.Error("diff finer than the scale parsed")
+	}
+
+	rawDiff.Bids = [][]string{{"30000.01", "0.50000"}, {"29999.00", "0"}}
+	rawDiff.Asks = [][]string{{"30000.02", "1.2"}}
+
+	want := orderbook.DepthDiff{
+		Time:          1700000000000,
+		FirstUpdateId: 157,
+		LastUpdateId:  160,
+		ReceiveTime:   1700000000012,
+		Bids:          orderbook.DepthLevel{3000001: 50000, 2999900: 0},
+		Asks:          orderbook.DepthLevel{3000002: 120000},
+	}
+
+	diff, err := rawDiff.ToDepthDiff(SCALE)
+	if err != nil || !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff %+v, %v, want %+v", diff, err, want)
+	}
+
+	rawDiff.Asks = [][]string{{"30000.02"}}
+	if _, err := rawDiff.ToDepthDiff(SCALE); err == nil {
+		t.Error("level without a quantity parsed")
+	}
+}
+
+func TestToOrderBook(t *testing.T) {
+	rawOB := RawOrderBook{
+		LastUpdateId: 1027024,
+		Bids:         [][]string{{"4.00", "431.00000"}},
+		Asks:         [][]string{{"4.000002", "12.00000"}},
+	}
+
+	if _, err := rawOB.ToOrderBook(SCALE); err == nil {
+		t.Error("book finer than the scale parsed")
+	}
+
+	rawOB.Asks = [][]string{{"4.01", "12.00000"}}
+
+	ob, err := rawOB.ToOrderBook(SCALE)
+	if err != nil || ob.UpdateId != 1027024 || ob.Scale != SCALE || !reflect.DeepEqual(ob.Bids, orderbook.DepthLevel{400: 43100000}) || !reflect.DeepEqual(ob.Asks, orderbook.DepthLevel{401: 1200000}) {
+		t.Errorf("book %+v, %v", ob, err)
+	}
+}
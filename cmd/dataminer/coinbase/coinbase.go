@@ -0,0 +1,224 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/crypto_pickle/internal/utils"
+)
+
+// Coinbase mines the level2 channel of the Coinbase Advanced Trade websocket.
+// Symbols are written as base-quote, e.g. btc-usd.
+//
+// The channel has no update ids, but every message of a connection carries a
+// sequence_num one higher than the previous message on any channel. A level2
+// message continues the previous one if no message was skipped in between, so
+// its FirstUpdateId is one past the previous level2 message and its
+// LastUpdateId its own sequence_num. A new connection starts with a snapshot.
+
+const (
+	NAME = "coinbase"
+
+	WS_URL      = "wss://advanced-trade-ws.coinbase.com"
+	PRODUCT_URL = "https://api.coinbase.com/api/v3/brokerage/market/products/"
+
+	REQUEST_LIMIT   = 10 // public REST requests per second
+	SUBSCRIBE_LIMIT = 8  // subscribe messages per second
+)
+
+type Coinbase struct {
+	limits exchange.Limits
+	scales *exchange.Scales
+}
+
+func New() exchange.Exchange {
+	return &Coinbase{
+		limits: exchange.Limits{
+			Requests:    exchange.NewLimiter(REQUEST_LIMIT, time.Second),
+			Connections: exchange.NewLimiter(SUBSCRIBE_LIMIT, time.Second),
+		},
+		scales: &exchange.Scales{},
+	}
+}
+
+func (cb *Coinbase) Name() string {
+	return NAME
+}
+
+func (cb *Coinbase) NormalizeSymbol(symbol string) string {
+	return strings.ToUpper(symbol)
+}
+
+func (cb *Coinbase) StorageSymbol(symbol string) string {
+	return exchange.StorageSymbol(NAME, symbol)
+}
+
+type rawProduct struct {
+	QuoteIncrement string `json:"quote_increment"`
+	BaseIncrement  string `json:"base_increment"`
+}
+
+func (cb *Coinbase) Scale(symbol string) (orderbook.Scale, error) {
+	return cb.scales.Get(cb.NormalizeSymbol(symbol), func(product string) (orderbook.Scale, error) {
+		var raw rawProduct
+		if err := exchange.GetJSON(PRODUCT_URL+product, 1, cb.limits, &raw); err != nil {
+			return orderbook.Scale{}, err
+		}
+
+		return orderbook.Scale{
+			PriceDecimals: utils.DecimalPlaces(raw.QuoteIncrement),
+			QtyDecimals:   utils.DecimalPlaces(raw.BaseIncrement),
+		}, nil
+	})
+}
+
+func (cb *Coinbase) Snapshot(symbol string, depth int32) (orderbook.OrderBook, error) {
+	return orderbook.OrderBook{}, exchange.ErrNoSnapshot
+}
+
+type rawSubscribe struct {
+	Type       string   `json:"type"`
+	ProductIds []string `json:"product_ids"`
+	Channel    string   `json:"channel"`
+}
+
+type rawMessage struct {
+	Channel     string     `json:"channel"`
+	Timestamp   string     `json:"timestamp"`
+	SequenceNum int64      `json:"sequence_num"`
+	Events      []rawEvent `json:"events"`
+}
+
+type rawEvent struct {
+	Type      string      `json:"type"`
+	ProductId string      `json:"product_id"`
+	Updates   []rawUpdate `json:"updates"`
+}
+
+type rawUpdate struct {
+	Side        string `json:"side"`
+	PriceLevel  string `json:"price_level"`
+	NewQuantity string `json:"new_quantity"`
+}
+
+// Subscribe streams the level2 channel of a product, heartbeats are
+// subscribed too so quiet products don't get disconnected. The whole book is
+// sent, depth is ignored.
+func (cb *Coinbase) Subscribe(symbol string, depth int32) (chan exchange.Update, chan struct{}, error) {
+	scale, err := cb.Scale(symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	product := cb.NormalizeSymbol(symbol)
+	subscribe := []interface{}{
+		rawSubscribe{Type: "subscribe", ProductIds: []string{product}, Channel: "level2"},
+		rawSubscribe{Type: "subscribe", ProductIds: []string{product}, Channel: "heartbeats"},
+	}
+
+	parser := &parser{scale: scale, product: product, lastSeq: -1, lastLevel2: -1}
+	return exchange.Stream(WS_URL, subscribe, cb.limits, parser.parse)
+}
+
+func (cb *Coinbase) Limits() exchange.Limits {
+	return cb.limits
+}
+
+// parser tracks the sequence numbers of one connection. skipped is set once a
+// message was skipped since the last level2 update.
+type parser struct {
+	scale   orderbook.Scale
+	product string
+
+	lastSeq    int64
+	lastLevel2 int64
+	skipped    bool
+}
+
+func (p *parser) parse(message []byte, receiveTime int64) ([]exchange.Update, error) {
+	var msg rawMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, err
+	}
+
+	if msg.SequenceNum != p.lastSeq+1 {
+		p.skipped = true
+	}
+	p.lastSeq = msg.SequenceNum
+
+	if msg.Channel != "l2_data" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, msg.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	// the events of a message share its sequence number, so they are merged
+	// into a single update
+	var snapshot *orderbook.OrderBook
+	diff := orderbook.DepthDiff{
+		Time:          t.UnixMilli(),
+		FirstUpdateId: p.lastLevel2 + 1,
+		LastUpdateId:  msg.SequenceNum,
+		ReceiveTime:   receiveTime,
+		Bids:          make(orderbook.DepthLevel),
+		Asks:          make(orderbook.DepthLevel),
+	}
+
+	for _, event := range msg.Events {
+		if event.ProductId != p.product {
+			continue
+		}
+
+		if event.Type == "snapshot" {
+			snapshot = &orderbook.OrderBook{
+				Time:        diff.Time,
+				UpdateId:    msg.SequenceNum,
+				ReceiveTime: receiveTime,
+				Scale:       p.scale,
+				Bids:        diff.Bids,
+				Asks:        diff.Asks,
+			}
+		}
+
+		for _, update := range event.Updates {
+			dl := diff.Bids
+			if update.Side != "bid" {
+				dl = diff.Asks
+			}
+
+			if err := exchange.SetLevel(dl, p.scale, update.PriceLevel, update.NewQuantity); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if snapshot == nil && len(diff.Bids) == 0 && len(diff.Asks) == 0 {
+		return nil, nil
+	}
+
+	if p.skipped || p.lastLevel2 < 0 {
+		diff.FirstUpdateId = msg.SequenceNum
+	}
+	p.lastLevel2, p.skipped = msg.SequenceNum, false
+
+	if snapshot != nil {
+		// levels of 0 in a snapshot would be removals in a diff
+		for _, dl := range []orderbook.DepthLevel{snapshot.Bids, snapshot.Asks} {
+			for price, qty := range dl {
+				if qty == 0 {
+					delete(dl, price)
+				}
+			}
+		}
+
+		return []exchange.Update{{Snapshot: snapshot}}, nil
+	}
+
+	return []exchange.Update{{Diff: diff}}, nil
+}
@@ -0,0 +1,122 @@
+package coinbase
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+var SCALE = orderbook.Scale{PriceDecimals: 2, QtyDecimals: 8}
+
+const (
+	SNAPSHOT = `{"channel":"l2_data","client_id":"","timestamp":"2023-02-09T20:32:50.714964855Z","sequence_num":0,"events":[{"type":"snapshot","product_id":"BTC-USD","updates":[
+		{"side":"bid","event_time":"1970-01-01T00:00:00Z","price_level":"21921.73","new_quantity":"0.06317902"},
+		{"side":"bid","event_time":"1970-01-01T00:00:00Z","price_level":"21921.30","new_quantity":"0"},
+		{"side":"offer","event_time":"1970-01-01T00:00:00Z","price_level":"21921.74","new_quantity":"1.5"}]}]}`
+
+	HEARTBEAT = `{"channel":"heartbeats","client_id":"","timestamp":"2023-02-09T20:32:51.000000000Z","sequence_num":1,"events":[{"current_time":"2023-02-09 20:32:51.0 +0000 UTC","heartbeat_counter":3}]}`
+
+	UPDATE = `{"channel":"l2_data","client_id":"","timestamp":"2023-02-09T20:32:51.114964855Z","sequence_num":2,"events":[{"type":"update","product_id":"BTC-USD","updates":[
+		{"side":"bid","event_time":"2023-02-09T20:32:51.1Z","price_level":"21921.73","new_quantity":"0"},
+		{"side":"offer","event_time":"2023-02-09T20:32:51.1Z","price_level":"21922.00","new_quantity":"0.25"}]}]}`
+
+	// sequence_num 3 was never received
+	UPDATE_AFTER_SKIP = `{"channel":"l2_data","client_id":"","timestamp":"2023-02-09T20:32:51.314964855Z","sequence_num":4,"events":[{"type":"update","product_id":"BTC-USD","updates":[
+		{"side":"bid","event_time":"2023-02-09T20:32:51.3Z","price_level":"21921.50","new_quantity":"2"}]}]}`
+
+	OTHER_PRODUCT = `{"channel":"l2_data","client_id":"","timestamp":"2023-02-09T20:32:51.414964855Z","sequence_num":5,"events":[{"type":"update","product_id":"ETH-USD","updates":[
+		{"side":"bid","event_time":"2023-02-09T20:32:51.4Z","price_level":"1650.00","new_quantity":"2"}]}]}`
+
+	UPDATE_AFTER_OTHER = `{"channel":"l2_data","client_id":"","timestamp":"2023-02-09T20:32:51.514964855Z","sequence_num":6,"events":[{"type":"update","product_id":"BTC-USD","updates":[
+		{"side":"offer","event_time":"2023-02-09T20:32:51.5Z","price_level":"21922.00","new_quantity":"0"}]}]}`
+)
+
+func TestParse(t *testing.T) {
+	p := &parser{scale: SCALE, product: "BTC-USD", lastSeq: -1, lastLevel2: -1}
+
+	updates, err := p.parse([]byte(SNAPSHOT), 1675974770720)
+	if err != nil || len(updates) != 1 || updates[0].Snapshot == nil {
+		t.Fatalf("snapshot: %v, %v", updates, err)
+	}
+
+	snapshot := updates[0].Snapshot
+	want := orderbook.OrderBook{
+		Time:        1675974770714,
+		UpdateId:    0,
+		ReceiveTime: 1675974770720,
+		Scale:       SCALE,
+		Bids:        orderbook.DepthLevel{2192173: 6317902},
+		Asks:        orderbook.DepthLevel{2192174: 150000000},
+	}
+	if !reflect.DeepEqual(*snapshot, want) {
+		t.Errorf("snapshot %+v, want %+v", *snapshot, want)
+	}
+
+	if updates, err := p.parse([]byte(HEARTBEAT), 1675974771000); err != nil || len(updates) != 0 {
+		t.Errorf("heartbeat: %v, %v", updates, err)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		want    *orderbook.DepthDiff
+	}{
+		{"update continuing the snapshot over a heartbeat", UPDATE, &orderbook.DepthDiff{
+			Time:          1675974771114,
+			FirstUpdateId: 1,
+			LastUpdateId:  2,
+			ReceiveTime:   1,
+			Bids:          orderbook.DepthLevel{2192173: 0},
+			Asks:          orderbook.DepthLevel{2192200: 25000000},
+		}},
+		{"update after a skipped message starts a gap", UPDATE_AFTER_SKIP, &orderbook.DepthDiff{
+			Time:          1675974771314,
+			FirstUpdateId: 4,
+			LastUpdateId:  4,
+			ReceiveTime:   1,
+			Bids:          orderbook.DepthLevel{2192150: 200000000},
+			Asks:          orderbook.DepthLevel{},
+		}},
+		{"update of another product", OTHER_PRODUCT, nil},
+		{"update after another product", UPDATE_AFTER_OTHER, &orderbook.DepthDiff{
+			Time:          1675974771514,
+			FirstUpdateId: 5,
+			LastUpdateId:  6,
+			ReceiveTime:   1,
+			Bids:          orderbook.DepthLevel{},
+			Asks:          orderbook.DepthLevel{2192200: 0},
+		}},
+	}
+
+	for _, test := range tests {
+		updates, err := p.parse([]byte(test.message), 1)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if test.want == nil {
+			if len(updates) != 0 {
+				t.Errorf("%s: %v, want no updates", test.name, updates)
+			}
+			continue
+		}
+
+		if len(updates) != 1 || updates[0].Snapshot != nil || !reflect.DeepEqual(updates[0].Diff, *test.want) {
+			t.Errorf("%s: %+v, want %+v", test.name, updates, *test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, message := range []string{
+		`{"channel":"l2_data"`,
+		`{"channel":"l2_data","timestamp":"yesterday","sequence_num":0,"events":[]}`,
+		`{"channel":"l2_data","timestamp":"2023-02-09T20:32:50Z","sequence_num":0,"events":[{"type":"snapshot","product_id":"BTC-USD","updates":[{"side":"bid","price_level":"x","new_quantity":"1"}]}]}`,
+	} {
+		p := &parser{scale: SCALE, product: "BTC-USD", lastSeq: -1, lastLevel2: -1}
+		if _, err := p.parse([]byte(message), 1); err == nil {
+			t.Errorf("%s parsed", message)
+		}
+	}
+}
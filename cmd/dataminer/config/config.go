@@ -6,14 +6,24 @@ type Config struct {
 	OrderbookFrames int `yaml:"OrderbookFrames"`
 	// How many frames should the miner should reserve to successfully change the current history
 	ChangeoverFrames int `yaml:"ChangeoverFrames"`
+	// How many frames between full snapshots embedded in each file for seeking. 0 disables keyframes
+	KeyframeFrames int `yaml:"KeyframeFrames"`
 
 	// buffer size for packager.
 	Buffer int `yaml:"Buffer"`
 
-	// formatring either bin or json
+	// name of a codec registered in internal/orderbook: json, msgpack, bin or col
 	Format string `yaml:"Format"`
 
-	// Symbols to mine
+	// compression of saved files, none, gzip or zstd
+	Compression string `yaml:"Compression"`
+	// compression level, 1-9 for gzip and 1-22 for zstd. 0 uses the default level
+	CompressionLevel int `yaml:"CompressionLevel"`
+
+	// Symbols to mine, prefixed with their exchange unless they're binance
+	// symbols, e.g. btcusdt, coinbase:btc-usd, kraken:btc-usd or okx:btc-usdt.
+	// Binance futures are mined from binance-usdm and binance-coinm, e.g.
+	// binance-usdm:btcusdt for the perpetual or binance-coinm:btcusd-250627
 	Symbols []string `yaml:"Symbols"`
 
 	// local location to save. If given then the dataminer will save locally to this location
@@ -13,7 +13,9 @@ func defaultConfig() Config {
 	return Config{
 		OrderbookFrames:  10 * 60 * 5,
 		ChangeoverFrames: 10 * 10,
+		KeyframeFrames:   10 * 30,
 		Filepath:         "temp",
+		Format:           "json",
 	}
 }
 
@@ -0,0 +1,114 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/crypto_pickle/internal/utils"
+)
+
+// Exchange is a venue the miner records depth from. Adapters translate the
+// books and diffs of their exchange into orderbook types, so the miner can
+// keep a local book in sync the same way for every venue:
+//
+// A local book starts from a snapshot with UpdateId L. Diffs with
+// LastUpdateId <= L are already part of it and skipped, every other diff must
+// continue the book, FirstUpdateId <= L+1, after which L is its
+// LastUpdateId. A diff with a PrevUpdateId of L continues the book as well,
+// and once L is the id of a diff, diffs with a PrevUpdateId only continue it
+// if theirs is L. Adapters for exchanges without update ids map whatever
+// sequencing the exchange provides onto them.
+type Exchange interface {
+	// Name is the name of the exchange in the miner config, e.g. binance.
+	Name() string
+
+	// NormalizeSymbol turns a symbol of the miner config into the symbol of
+	// the exchange, e.g. btc-usd into BTC-USD on coinbase.
+	NormalizeSymbol(symbol string) string
+
+	// StorageSymbol is the symbol histories of a config symbol are stored
+	// under, the same symbol of different exchanges must not collide.
+	StorageSymbol(symbol string) string
+
+	// Scale returns the price and quantity decimals of a symbol.
+	Scale(symbol string) (orderbook.Scale, error)
+
+	// Snapshot fetches up to depth levels per side of the book of a symbol
+	// from the REST api of the exchange, or returns ErrNoSnapshot if the
+	// exchange sends its snapshots at the start of a Subscribe stream.
+	Snapshot(symbol string, depth int32) (orderbook.OrderBook, error)
+
+	// Subscribe streams the depth of a symbol until done is closed. The stream
+	// is closed if the connection fails.
+	Subscribe(symbol string, depth int32) (updates chan Update, done chan struct{}, err error)
+
+	// Limits are the rate limits the adapter waits on before each request,
+	// shared by every symbol mined from the exchange.
+	Limits() Limits
+}
+
+var ErrNoSnapshot = errors.New("exchange has no snapshots outside of its depth stream")
+
+// Update is a message of a depth stream, either a snapshot replacing the
+// local book or a diff to apply to it.
+type Update struct {
+	Snapshot *orderbook.OrderBook
+	Diff     orderbook.DepthDiff
+
+	// PrevUpdateId is the LastUpdateId of the diff before Diff on streams
+	// whose update ids aren't consecutive, e.g. the pu of binance futures, and
+	// 0 on others. Such a diff continues a book synced from the stream exactly
+	// if PrevUpdateId is its L. The first diff after a snapshot continues it
+	// as well if FirstUpdateId <= L+1, its predecessor may end before L.
+	PrevUpdateId int64
+}
+
+type Limits struct {
+	Requests    *Limiter // weight of REST requests
+	Connections *Limiter // websocket connections and subscriptions
+}
+
+// ParseSymbol splits a symbol of the miner config into its exchange and
+// symbol, e.g. coinbase:btc-usd. Symbols without an exchange are binance
+// symbols, the only exchange mined before others were added.
+func ParseSymbol(symbol string) (string, string) {
+	if name, symbol, ok := strings.Cut(symbol, ":"); ok {
+		return name, symbol
+	}
+
+	return "binance", symbol
+}
+
+// SplitPair splits a config symbol of the form base-quote, e.g. btc-usd.
+func SplitPair(symbol string) (string, string, error) {
+	base, quote, ok := strings.Cut(symbol, "-")
+	if !ok || base == "" || quote == "" {
+		return "", "", fmt.Errorf("symbol %s must be written as base-quote, e.g. btc-usd", symbol)
+	}
+
+	return base, quote, nil
+}
+
+// StorageSymbol prefixes the base and quote of a pair with the exchange name,
+// e.g. okx-btcusdt.
+func StorageSymbol(name, symbol string) string {
+	return name + "-" + strings.ToLower(strings.Replace(symbol, "-", "", 1))
+}
+
+// SetLevel parses a price and quantity as sent by an exchange into dl.
+func SetLevel(dl orderbook.DepthLevel, scale orderbook.Scale, price, qty string) error {
+	priceTicks, err := utils.ParseFixed(price, scale.PriceDecimals)
+	if err != nil {
+		return err
+	}
+
+	qtyLots, err := utils.ParseFixed(qty, scale.QtyDecimals)
+	if err != nil {
+		return err
+	}
+
+	dl[priceTicks] = qtyLots
+	return nil
+}
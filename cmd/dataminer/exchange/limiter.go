@@ -0,0 +1,43 @@
+package exchange
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter spends a budget of request weight, each spent weight is given back
+// once period has passed. It matches the request weight limits of binance and
+// counts requests on exchanges limiting by number, where every request has a
+// weight of 1.
+type Limiter struct {
+	weight int32
+	period time.Duration
+
+	mu   sync.Mutex
+	cond *sync.Cond
+}
+
+func NewLimiter(weight int32, period time.Duration) *Limiter {
+	limiter := &Limiter{weight: weight, period: period}
+	limiter.cond = sync.NewCond(&limiter.mu)
+
+	return limiter
+}
+
+// Wait blocks until weight can be spent.
+func (limiter *Limiter) Wait(weight int32) {
+	limiter.mu.Lock()
+	for weight > limiter.weight {
+		limiter.cond.Wait()
+	}
+	limiter.weight -= weight
+	limiter.mu.Unlock()
+
+	time.AfterFunc(limiter.period, func() {
+		limiter.mu.Lock()
+		limiter.weight += weight
+		limiter.mu.Unlock()
+
+		limiter.cond.Broadcast()
+	})
+}
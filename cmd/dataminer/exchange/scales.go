@@ -0,0 +1,43 @@
+package exchange
+
+import (
+	"sync"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// Scales caches the scales of symbols so each is only looked up once.
+type Scales struct {
+	mu     sync.Mutex
+	scales map[string]orderbook.Scale
+}
+
+func (scales *Scales) Get(symbol string, lookup func(symbol string) (orderbook.Scale, error)) (orderbook.Scale, error) {
+	scales.mu.Lock()
+	defer scales.mu.Unlock()
+
+	if scale, ok := scales.scales[symbol]; ok {
+		return scale, nil
+	}
+
+	scale, err := lookup(symbol)
+	if err != nil {
+		return scale, err
+	}
+
+	if scales.scales == nil {
+		scales.scales = make(map[string]orderbook.Scale)
+	}
+	scales.scales[symbol] = scale
+
+	return scale, nil
+}
+
+// Forget drops the cached scale of a symbol, so the next Get looks it up
+// again, e.g. after its tick size changed.
+func (scales *Scales) Forget(symbol string) {
+	scales.mu.Lock()
+	defer scales.mu.Unlock()
+
+	delete(scales.scales, symbol)
+}
@@ -0,0 +1,118 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ParseFunc parses a websocket message into updates, messages other than depth
+// (acks, heartbeats) parse into none. An error closes the stream.
+type ParseFunc func(message []byte, receiveTime int64) ([]Update, error)
+
+// Stream dials url, sends the subscribe messages and streams the updates
+// parsed from every message until done is closed.
+func Stream(url string, subscribe []interface{}, limits Limits, parse ParseFunc) (chan Update, chan struct{}, error) {
+	return StreamPing(url, subscribe, "", 0, limits, parse)
+}
+
+// StreamPing is Stream for exchanges that close idle connections, sending the
+// text message ping every interval.
+func StreamPing(url string, subscribe []interface{}, ping string, interval time.Duration, limits Limits, parse ParseFunc) (chan Update, chan struct{}, error) {
+	updates, done := make(chan Update, 10), make(chan struct{})
+
+	limits.Connections.Wait(1)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, msg := range subscribe {
+		if err := conn.WriteJSON(msg); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	if ping != "" {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					// the reader closes the connection on failure, a failed
+					// ping only ends the pings
+					if err := conn.WriteMessage(websocket.TextMessage, []byte(ping)); err != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer conn.Close()
+		defer close(updates)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				log.Printf("Depth stream %s failed: %s \n", url, err)
+				return
+			}
+
+			parsed, err := parse(message, time.Now().UnixMilli())
+			if err != nil {
+				log.Printf("Depth stream %s failed: %s \n", url, err)
+				return
+			}
+
+			for _, update := range parsed {
+				select {
+				case updates <- update:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return updates, done, nil
+}
+
+// GetJSON decodes the response of a REST request of the given weight.
+func GetJSON(url string, weight int32, limits Limits, v interface{}) error {
+	limits.Requests.Wait(weight)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, body)
+	}
+
+	return json.Unmarshal(body, v)
+}
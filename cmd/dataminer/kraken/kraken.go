@@ -0,0 +1,332 @@
+package kraken
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// Kraken mines the book channel of the Kraken websocket api v2. Symbols are
+// written as base-quote, e.g. btc-usd.
+//
+// The book channel has no update ids. Instead every message carries a CRC32
+// checksum of the top 10 levels of each side, so the adapter keeps its own
+// copy of the book and numbers the messages of a connection itself: an update
+// whose checksum matches continues the previous one, one that doesn't skips
+// an id so the miner sees a gap and resubscribes for a new snapshot.
+//
+// Kraken doesn't send removals for levels pushed out of the subscribed depth,
+// they are added to the diffs as the book is truncated after each update.
+
+const (
+	NAME = "kraken"
+
+	WS_URL = "wss://ws.kraken.com/v2"
+
+	CONNECTION_LIMIT  = 1 // connections per CONNECTION_PERIOD
+	CONNECTION_PERIOD = time.Second
+	CHECKSUM_LEVELS   = 10
+)
+
+// DEPTHS are the depths the book channel can be subscribed with.
+var DEPTHS = []int32{10, 25, 100, 500, 1000}
+
+type Kraken struct {
+	limits exchange.Limits
+	scales *exchange.Scales
+}
+
+func New() exchange.Exchange {
+	return &Kraken{
+		limits: exchange.Limits{
+			// scales are read from the websocket api, kraken has no REST
+			// requests here
+			Requests:    exchange.NewLimiter(1, time.Second),
+			Connections: exchange.NewLimiter(CONNECTION_LIMIT, CONNECTION_PERIOD),
+		},
+		scales: &exchange.Scales{},
+	}
+}
+
+func (kr *Kraken) Name() string {
+	return NAME
+}
+
+func (kr *Kraken) NormalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.Replace(symbol, "-", "/", 1))
+}
+
+func (kr *Kraken) StorageSymbol(symbol string) string {
+	return exchange.StorageSymbol(NAME, symbol)
+}
+
+type rawRequest struct {
+	Method string    `json:"method"`
+	Params rawParams `json:"params"`
+}
+
+type rawParams struct {
+	Channel string   `json:"channel"`
+	Symbol  []string `json:"symbol,omitempty"`
+	Depth   int32    `json:"depth,omitempty"`
+}
+
+type rawMessage struct {
+	Channel string          `json:"channel"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type rawInstruments struct {
+	Pairs []struct {
+		Symbol         string `json:"symbol"`
+		PricePrecision int32  `json:"price_precision"`
+		QtyPrecision   int32  `json:"qty_precision"`
+	} `json:"pairs"`
+}
+
+// Scale reads the precision of a pair from the snapshot of the instrument
+// channel.
+func (kr *Kraken) Scale(symbol string) (orderbook.Scale, error) {
+	return kr.scales.Get(kr.NormalizeSymbol(symbol), func(pair string) (orderbook.Scale, error) {
+		kr.limits.Connections.Wait(1)
+		conn, _, err := websocket.DefaultDialer.Dial(WS_URL, nil)
+		if err != nil {
+			return orderbook.Scale{}, err
+		}
+		defer conn.Close()
+
+		if err := conn.WriteJSON(rawRequest{Method: "subscribe", Params: rawParams{Channel: "instrument"}}); err != nil {
+			return orderbook.Scale{}, err
+		}
+
+		for {
+			var msg rawMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return orderbook.Scale{}, err
+			}
+
+			if msg.Channel != "instrument" || msg.Type != "snapshot" {
+				continue
+			}
+
+			var instruments rawInstruments
+			if err := json.Unmarshal(msg.Data, &instruments); err != nil {
+				return orderbook.Scale{}, err
+			}
+
+			for _, p := range instruments.Pairs {
+				if p.Symbol == pair {
+					return orderbook.Scale{PriceDecimals: p.PricePrecision, QtyDecimals: p.QtyPrecision}, nil
+				}
+			}
+
+			return orderbook.Scale{}, fmt.Errorf("kraken has no pair %s", pair)
+		}
+	})
+}
+
+func (kr *Kraken) Snapshot(symbol string, depth int32) (orderbook.OrderBook, error) {
+	return orderbook.OrderBook{}, exchange.ErrNoSnapshot
+}
+
+// Subscribe streams the book of a pair at the largest depth kraken offers up
+// to depth.
+func (kr *Kraken) Subscribe(symbol string, depth int32) (chan exchange.Update, chan struct{}, error) {
+	scale, err := kr.Scale(symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bookDepth := DEPTHS[0]
+	for _, d := range DEPTHS {
+		if d <= depth {
+			bookDepth = d
+		}
+	}
+
+	pair := kr.NormalizeSymbol(symbol)
+	subscribe := []interface{}{
+		rawRequest{Method: "subscribe", Params: rawParams{Channel: "book", Symbol: []string{pair}, Depth: bookDepth}},
+	}
+
+	parser := &parser{scale: scale, pair: pair, depth: int(bookDepth)}
+	return exchange.Stream(WS_URL, subscribe, kr.limits, parser.parse)
+}
+
+func (kr *Kraken) Limits() exchange.Limits {
+	return kr.limits
+}
+
+type rawBook struct {
+	Symbol    string     `json:"symbol"`
+	Bids      []rawLevel `json:"bids"`
+	Asks      []rawLevel `json:"asks"`
+	Checksum  uint32     `json:"checksum"`
+	Timestamp string     `json:"timestamp"`
+}
+
+type rawLevel struct {
+	Price json.Number `json:"price"`
+	Qty   json.Number `json:"qty"`
+}
+
+// parser keeps the book of one connection to verify checksums.
+type parser struct {
+	scale orderbook.Scale
+	pair  string
+	depth int
+
+	book *orderbook.SortedOrderBook
+	seq  int64
+}
+
+func (p *parser) parse(message []byte, receiveTime int64) ([]exchange.Update, error) {
+	var msg rawMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, err
+	}
+
+	if msg.Channel != "book" {
+		return nil, nil
+	}
+
+	// prices and quantities are json numbers, decoding them as floats would
+	// lose their exact decimal value
+	dec := json.NewDecoder(bytes.NewReader(msg.Data))
+	dec.UseNumber()
+
+	var books []rawBook
+	if err := dec.Decode(&books); err != nil {
+		return nil, err
+	}
+
+	updates := make([]exchange.Update, 0, len(books))
+	for _, raw := range books {
+		if raw.Symbol != p.pair {
+			continue
+		}
+
+		diff := orderbook.DepthDiff{
+			Time:        receiveTime,
+			ReceiveTime: receiveTime,
+			Bids:        make(orderbook.DepthLevel),
+			Asks:        make(orderbook.DepthLevel),
+		}
+
+		if raw.Timestamp != "" {
+			t, err := time.Parse(time.RFC3339Nano, raw.Timestamp)
+			if err != nil {
+				return nil, err
+			}
+			diff.Time = t.UnixMilli()
+		}
+
+		for _, side := range []struct {
+			levels []rawLevel
+			dl     orderbook.DepthLevel
+		}{{raw.Bids, diff.Bids}, {raw.Asks, diff.Asks}} {
+			for _, level := range side.levels {
+				if err := exchange.SetLevel(side.dl, p.scale, decimal(level.Price), decimal(level.Qty)); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if msg.Type == "snapshot" {
+			snapshot := orderbook.OrderBook{Time: diff.Time, ReceiveTime: receiveTime, Scale: p.scale, Bids: diff.Bids, Asks: diff.Asks}
+			p.book = snapshot.ToSortedOrderBook()
+
+			p.seq++
+			snapshot.UpdateId = p.seq
+
+			if p.checksum() != raw.Checksum {
+				return nil, fmt.Errorf("checksum of %s snapshot doesn't match", p.pair)
+			}
+
+			updates = append(updates, exchange.Update{Snapshot: &snapshot})
+			continue
+		}
+
+		if p.book == nil {
+			continue
+		}
+
+		p.book.ApplyDepthDiff(diff)
+		p.truncate(diff)
+
+		diff.FirstUpdateId, diff.LastUpdateId = p.seq+1, p.seq+1
+		if p.checksum() != raw.Checksum {
+			log.Printf("Checksum of %s update doesn't match \n", p.pair)
+			diff.FirstUpdateId, diff.LastUpdateId = p.seq+2, p.seq+2
+		}
+		p.seq = diff.LastUpdateId
+
+		updates = append(updates, exchange.Update{Diff: diff})
+	}
+
+	return updates, nil
+}
+
+// truncate removes the levels beyond the subscribed depth from the book,
+// recording their removal in diff.
+func (p *parser) truncate(diff orderbook.DepthDiff) {
+	for p.book.Bids.Len() > p.depth {
+		level, _ := p.book.Bids.Lowest()
+		p.book.Bids.Set(level[0], 0)
+		diff.Bids[level[0]] = 0
+	}
+
+	for p.book.Asks.Len() > p.depth {
+		level, _ := p.book.Asks.Highest()
+		p.book.Asks.Set(level[0], 0)
+		diff.Asks[level[0]] = 0
+	}
+}
+
+// checksum is the CRC32 of the top asks then the top bids, each level written
+// as its price and quantity without decimal point or leading zeros, which in
+// ticks and lots of the pair's precision is just the integer.
+func (p *parser) checksum() uint32 {
+	buf := make([]byte, 0, 512)
+
+	asks := p.book.Asks.LowestN(CHECKSUM_LEVELS)
+	for _, level := range asks {
+		buf = strconv.AppendInt(buf, level[0], 10)
+		buf = strconv.AppendInt(buf, level[1], 10)
+	}
+
+	bids := p.book.Bids.HighestN(CHECKSUM_LEVELS)
+	for i := len(bids) - 1; i >= 0; i-- {
+		buf = strconv.AppendInt(buf, bids[i][0], 10)
+		buf = strconv.AppendInt(buf, bids[i][1], 10)
+	}
+
+	return crc32.ChecksumIEEE(buf)
+}
+
+// decimal returns a json number in plain decimal notation, kraken writes
+// small quantities in exponent notation, e.g. 1e-05.
+func decimal(n json.Number) string {
+	s := n.String()
+	if !strings.ContainsAny(s, "eE") {
+		return s
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return s
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,153 @@
+package kraken
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+var SCALE = orderbook.Scale{PriceDecimals: 1, QtyDecimals: 8}
+
+// krakenChecksum computes a checksum from the levels as kraken writes them,
+// following its docs rather than the ticks and lots the parser works with.
+func krakenChecksum(asks, bids [][2]string) uint32 {
+	strip := func(s string) string {
+		return strings.TrimLeft(strings.Replace(s, ".", "", 1), "0")
+	}
+
+	buf := ""
+	for _, side := range [][][2]string{asks, bids} {
+		for i, level := range side {
+			if i < CHECKSUM_LEVELS {
+				buf += strip(level[0]) + strip(level[1])
+			}
+		}
+	}
+
+	return crc32.ChecksumIEEE([]byte(buf))
+}
+
+func levels(side [][2]string) string {
+	parts := make([]string, len(side))
+	for i, level := range side {
+		parts[i] = fmt.Sprintf(`{"price":%s,"qty":%s}`, level[0], level[1])
+	}
+
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+func bookMessage(kind string, bids, asks [][2]string, checksum uint32, timestamp string) []byte {
+	return []byte(fmt.Sprintf(`{"channel":"book","type":"%s","data":[{"symbol":"BTC/USD","bids":%s,"asks":%s,"checksum":%d,"timestamp":"%s"}]}`,
+		kind, levels(bids), levels(asks), checksum, timestamp))
+}
+
+// testBook returns 10 levels per side, best first: bids from 50000.0 down to
+// 49991.9, asks from 50001.0 up to 50010.9.
+func testBook() (bids, asks [][2]string) {
+	for i := 0; i < 10; i++ {
+		bids = append(bids, [2]string{fmt.Sprintf("%d.%d", 50000-i, i), fmt.Sprintf("1.%08d", 1000+i)})
+		asks = append(asks, [2]string{fmt.Sprintf("%d.%d", 50001+i, i), fmt.Sprintf("0.%08d", 1000+i)})
+	}
+
+	return bids, asks
+}
+
+func TestParse(t *testing.T) {
+	p := &parser{scale: SCALE, pair: "BTC/USD", depth: 10}
+	bids, asks := testBook()
+
+	snapshot := bookMessage("snapshot", bids, asks, krakenChecksum(asks, bids), "2023-10-06T17:35:55.440295Z")
+	updates, err := p.parse(snapshot, 1696613755445)
+	if err != nil || len(updates) != 1 || updates[0].Snapshot == nil {
+		t.Fatalf("snapshot: %v, %v", updates, err)
+	}
+
+	if ob := updates[0].Snapshot; ob.UpdateId != 1 || ob.Time != 1696613755440 || ob.ReceiveTime != 1696613755445 || len(ob.Bids) != 10 || len(ob.Asks) != 10 || ob.Bids[500000] != 100001000 || ob.Asks[500109] != 1009 {
+		t.Errorf("snapshot %+v", *ob)
+	}
+
+	// a new best bid pushes the lowest bid out of the subscribed depth, kraken
+	// doesn't send its removal
+	newBids := append([][2]string{{"50000.5", "0.00001000"}}, bids[:9]...)
+	update := []byte(fmt.Sprintf(`{"channel":"book","type":"update","data":[{"symbol":"BTC/USD","bids":[{"price":50000.5,"qty":1e-05}],"asks":[],"checksum":%d,"timestamp":"2023-10-06T17:35:55.540295Z"}]}`,
+		krakenChecksum(asks, newBids)))
+
+	updates, err = p.parse(update, 1696613755545)
+	if err != nil || len(updates) != 1 {
+		t.Fatalf("update: %v, %v", updates, err)
+	}
+
+	want := orderbook.DepthDiff{
+		Time:          1696613755540,
+		FirstUpdateId: 2,
+		LastUpdateId:  2,
+		ReceiveTime:   1696613755545,
+		Bids:          orderbook.DepthLevel{500005: 1000, 499919: 0},
+		Asks:          orderbook.DepthLevel{},
+	}
+	if !reflect.DeepEqual(updates[0].Diff, want) {
+		t.Errorf("update %+v, want %+v", updates[0].Diff, want)
+	}
+
+	// a checksum that doesn't match the book skips an id, so the miner sees a
+	// gap and takes a new snapshot
+	wrong := []byte(fmt.Sprintf(`{"channel":"book","type":"update","data":[{"symbol":"BTC/USD","bids":[],"asks":[{"price":50001.0,"qty":0.5}],"checksum":%d,"timestamp":"2023-10-06T17:35:55.640295Z"}]}`,
+		krakenChecksum(asks, newBids)))
+
+	updates, err = p.parse(wrong, 1696613755645)
+	if err != nil || len(updates) != 1 {
+		t.Fatalf("update: %v, %v", updates, err)
+	}
+
+	if diff := updates[0].Diff; diff.FirstUpdateId != 4 || diff.LastUpdateId != 4 {
+		t.Errorf("update with a wrong checksum has ids %d to %d, want 4 to 4", diff.FirstUpdateId, diff.LastUpdateId)
+	}
+
+	// a new snapshot restarts the book
+	updates, err = p.parse(snapshot, 1696613755745)
+	if err != nil || len(updates) != 1 || updates[0].Snapshot == nil || updates[0].Snapshot.UpdateId != 5 {
+		t.Errorf("second snapshot: %v, %v", updates, err)
+	}
+}
+
+func TestParseSkipped(t *testing.T) {
+	p := &parser{scale: SCALE, pair: "BTC/USD", depth: 10}
+	bids, _ := testBook()
+
+	tests := []struct {
+		name    string
+		message []byte
+	}{
+		{"heartbeat", []byte(`{"channel":"heartbeat"}`)},
+		{"update before a snapshot", bookMessage("update", bids[:1], nil, 0, "2023-10-06T17:35:55.440295Z")},
+		{"snapshot of another pair", []byte(`{"channel":"book","type":"snapshot","data":[{"symbol":"ETH/USD","bids":[],"asks":[],"checksum":0}]}`)},
+	}
+
+	for _, test := range tests {
+		if updates, err := p.parse(test.message, 1); err != nil || len(updates) != 0 {
+			t.Errorf("%s: %v, %v", test.name, updates, err)
+		}
+	}
+}
+
+func TestParseSnapshotChecksum(t *testing.T) {
+	p := &parser{scale: SCALE, pair: "BTC/USD", depth: 10}
+	bids, asks := testBook()
+
+	if _, err := p.parse(bookMessage("snapshot", bids, asks, krakenChecksum(asks, bids)+1, "2023-10-06T17:35:55.440295Z"), 1); err == nil {
+		t.Error("snapshot with a wrong checksum parsed")
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	for in, want := range map[string]string{"0.5": "0.5", "1e-05": "0.00001", "2.5E-7": "0.00000025", "50000.1": "50000.1"} {
+		if got := decimal(json.Number(in)); got != want {
+			t.Errorf("decimal(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -7,7 +7,11 @@ import (
 	"time"
 
 	"github.com/crypto_pickle/cmd/dataminer/binance"
+	"github.com/crypto_pickle/cmd/dataminer/coinbase"
 	"github.com/crypto_pickle/cmd/dataminer/config"
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
+	"github.com/crypto_pickle/cmd/dataminer/kraken"
+	"github.com/crypto_pickle/cmd/dataminer/okx"
 	"github.com/crypto_pickle/cmd/dataminer/packager"
 	"github.com/crypto_pickle/internal/s3_client"
 )
@@ -15,6 +19,23 @@ import (
 var filepath = flag.String("config", "", "file path to configuration")
 var MyConfig config.Config
 
+// EXCHANGES makes the adapter of each exchange symbols can be mined from
+var EXCHANGES = map[string]func() exchange.Exchange{
+	binance.SPOT.Name:  newBinance(binance.SPOT),
+	binance.USDM.Name:  newBinance(binance.USDM),
+	binance.COINM.Name: newBinance(binance.COINM),
+	coinbase.NAME:      coinbase.New,
+	kraken.NAME:        kraken.New,
+	okx.NAME:           okx.New,
+}
+
+func newBinance(market binance.Market) func() exchange.Exchange {
+	return func() exchange.Exchange {
+		client := binance.NewMarketClient(market)
+		return &client
+	}
+}
+
 func main() {
 	flag.Parse()
 
@@ -22,15 +43,13 @@ func main() {
 
 	startLogger()
 
-	binance := binance.NewClient()
-
 	var s3 *s3_client.S3Client
 	if MyConfig.Aws == 1 {
 		temp := s3_client.NewClient(MyConfig.Key, MyConfig.Secret, MyConfig.Region)
 		s3 = &temp
 	}
 
-	dataPackager := packager.New(MyConfig.Buffer, s3, MyConfig.Filepath, MyConfig.Format, &binance)
+	dataPackager := packager.New(MyConfig.Buffer, s3, MyConfig.Filepath, MyConfig.Format, MyConfig.Compression, MyConfig.CompressionLevel)
 
 	startStreamMiners(&dataPackager)
 	dataPackager.Start()
@@ -53,8 +72,24 @@ func startLogger() {
 }
 
 func startStreamMiners(dataPackager *packager.Packager) {
-	packager.Configure(MyConfig.OrderbookFrames, MyConfig.ChangeoverFrames)
-	for _, symbol := range MyConfig.Symbols {
-		dataPackager.StartStreamMiner(symbol, 5000)
+	packager.Configure(MyConfig.OrderbookFrames, MyConfig.ChangeoverFrames, MyConfig.KeyframeFrames)
+
+	// symbols of an exchange share its adapter and with it its rate limits
+	exchanges := make(map[string]exchange.Exchange)
+	for _, configSymbol := range MyConfig.Symbols {
+		name, symbol := exchange.ParseSymbol(configSymbol)
+
+		ex, ok := exchanges[name]
+		if !ok {
+			newExchange, ok := EXCHANGES[name]
+			if !ok {
+				log.Fatalf("Unknown exchange %s of symbol %s \n", name, configSymbol)
+			}
+
+			ex = newExchange()
+			exchanges[name] = ex
+		}
+
+		dataPackager.StartStreamMiner(ex, symbol, 5000)
 	}
 }
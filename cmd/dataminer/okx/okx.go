@@ -0,0 +1,214 @@
+package okx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/crypto_pickle/internal/utils"
+)
+
+// OKX mines the books channel (400 levels) of the OKX public websocket.
+// Symbols are written as base-quote, e.g. btc-usdt.
+//
+// Every message of the channel has a seqId and the prevSeqId of the message
+// before it, so an update spans the ids prevSeqId+1 to seqId. Updates without
+// changes repeat the seqId and are skipped by the miner, a reset sequence
+// looks like a gap and starts a new history. A new connection starts with a
+// snapshot.
+
+const (
+	NAME = "okx"
+
+	WS_URL          = "wss://ws.okx.com:8443/ws/v5/public"
+	INSTRUMENTS_URL = "https://www.okx.com/api/v5/public/instruments?instType=SPOT&instId="
+
+	REQUEST_LIMIT    = 20 // public REST requests per REQUEST_PERIOD
+	REQUEST_PERIOD   = 2 * time.Second
+	CONNECTION_LIMIT = 3 // connections per second
+
+	// okx closes connections without messages for 30 seconds
+	PING_INTERVAL = 20 * time.Second
+)
+
+type OKX struct {
+	limits exchange.Limits
+	scales *exchange.Scales
+}
+
+func New() exchange.Exchange {
+	return &OKX{
+		limits: exchange.Limits{
+			Requests:    exchange.NewLimiter(REQUEST_LIMIT, REQUEST_PERIOD),
+			Connections: exchange.NewLimiter(CONNECTION_LIMIT, time.Second),
+		},
+		scales: &exchange.Scales{},
+	}
+}
+
+func (okx *OKX) Name() string {
+	return NAME
+}
+
+func (okx *OKX) NormalizeSymbol(symbol string) string {
+	return strings.ToUpper(symbol)
+}
+
+func (okx *OKX) StorageSymbol(symbol string) string {
+	return exchange.StorageSymbol(NAME, symbol)
+}
+
+type rawInstruments struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+	Data []struct {
+		TickSz string `json:"tickSz"`
+		LotSz  string `json:"lotSz"`
+	} `json:"data"`
+}
+
+func (okx *OKX) Scale(symbol string) (orderbook.Scale, error) {
+	return okx.scales.Get(okx.NormalizeSymbol(symbol), func(instId string) (orderbook.Scale, error) {
+		var raw rawInstruments
+		if err := exchange.GetJSON(INSTRUMENTS_URL+instId, 1, okx.limits, &raw); err != nil {
+			return orderbook.Scale{}, err
+		}
+
+		if raw.Code != "0" || len(raw.Data) == 0 {
+			return orderbook.Scale{}, fmt.Errorf("okx has no instrument %s: %s", instId, raw.Msg)
+		}
+
+		return orderbook.Scale{
+			PriceDecimals: utils.DecimalPlaces(raw.Data[0].TickSz),
+			QtyDecimals:   utils.DecimalPlaces(raw.Data[0].LotSz),
+		}, nil
+	})
+}
+
+func (okx *OKX) Snapshot(symbol string, depth int32) (orderbook.OrderBook, error) {
+	return orderbook.OrderBook{}, exchange.ErrNoSnapshot
+}
+
+type rawArg struct {
+	Channel string `json:"channel"`
+	InstId  string `json:"instId"`
+}
+
+type rawRequest struct {
+	Op   string   `json:"op"`
+	Args []rawArg `json:"args"`
+}
+
+// Subscribe streams the books channel, depth is ignored as okx only offers
+// 400 levels at 100ms.
+func (okx *OKX) Subscribe(symbol string, depth int32) (chan exchange.Update, chan struct{}, error) {
+	scale, err := okx.Scale(symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	instId := okx.NormalizeSymbol(symbol)
+	subscribe := []interface{}{
+		rawRequest{Op: "subscribe", Args: []rawArg{{Channel: "books", InstId: instId}}},
+	}
+
+	parser := &parser{scale: scale, instId: instId}
+	return exchange.StreamPing(WS_URL, subscribe, "ping", PING_INTERVAL, okx.limits, parser.parse)
+}
+
+func (okx *OKX) Limits() exchange.Limits {
+	return okx.limits
+}
+
+type rawMessage struct {
+	Event  string    `json:"event"`
+	Msg    string    `json:"msg"`
+	Arg    rawArg    `json:"arg"`
+	Action string    `json:"action"`
+	Data   []rawBook `json:"data"`
+}
+
+type rawBook struct {
+	Asks      [][]string `json:"asks"` // price, quantity, deprecated, orders
+	Bids      [][]string `json:"bids"`
+	Ts        string     `json:"ts"`
+	SeqId     int64      `json:"seqId"`
+	PrevSeqId int64      `json:"prevSeqId"`
+}
+
+type parser struct {
+	scale  orderbook.Scale
+	instId string
+}
+
+func (p *parser) parse(message []byte, receiveTime int64) ([]exchange.Update, error) {
+	// replies to pings aren't json
+	if string(message) == "pong" {
+		return nil, nil
+	}
+
+	var msg rawMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, err
+	}
+
+	if msg.Event == "error" {
+		return nil, fmt.Errorf("okx: %s", msg.Msg)
+	}
+
+	if msg.Arg.Channel != "books" || msg.Arg.InstId != p.instId {
+		return nil, nil
+	}
+
+	updates := make([]exchange.Update, 0, len(msg.Data))
+	for _, raw := range msg.Data {
+		t, err := strconv.ParseInt(raw.Ts, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		diff := orderbook.DepthDiff{
+			Time:          t,
+			FirstUpdateId: raw.PrevSeqId + 1,
+			LastUpdateId:  raw.SeqId,
+			ReceiveTime:   receiveTime,
+			Bids:          make(orderbook.DepthLevel),
+			Asks:          make(orderbook.DepthLevel),
+		}
+
+		for _, side := range []struct {
+			levels [][]string
+			dl     orderbook.DepthLevel
+		}{{raw.Bids, diff.Bids}, {raw.Asks, diff.Asks}} {
+			for _, level := range side.levels {
+				if len(level) < 2 {
+					return nil, fmt.Errorf("invalid okx level %v", level)
+				}
+
+				if err := exchange.SetLevel(side.dl, p.scale, level[0], level[1]); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if msg.Action == "snapshot" {
+			updates = append(updates, exchange.Update{Snapshot: &orderbook.OrderBook{
+				Time:        t,
+				UpdateId:    raw.SeqId,
+				ReceiveTime: receiveTime,
+				Scale:       p.scale,
+				Bids:        diff.Bids,
+				Asks:        diff.Asks,
+			}})
+			continue
+		}
+
+		updates = append(updates, exchange.Update{Diff: diff})
+	}
+
+	return updates, nil
+}
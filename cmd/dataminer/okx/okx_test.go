@@ -0,0 +1,114 @@
+package okx
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+var SCALE = orderbook.Scale{PriceDecimals: 2, QtyDecimals: 8}
+
+const (
+	SNAPSHOT = `{"arg":{"channel":"books","instId":"BTC-USDT"},"action":"snapshot","data":[{
+		"asks":[["8476.98","415","0","13"],["8477","7","0","2"]],
+		"bids":[["8476.9","0.25","0","1"]],
+		"ts":"1597026383085","checksum":-855196043,"prevSeqId":-1,"seqId":123456}]}`
+
+	UPDATE = `{"arg":{"channel":"books","instId":"BTC-USDT"},"action":"update","data":[{
+		"asks":[["8477","0","0","0"]],
+		"bids":[["8476.5","1.5","0","3"]],
+		"ts":"1597026383185","checksum":0,"prevSeqId":123456,"seqId":123461}]}`
+
+	// okx repeats the seqId of updates without changes
+	UPDATE_WITHOUT_CHANGES = `{"arg":{"channel":"books","instId":"BTC-USDT"},"action":"update","data":[{
+		"asks":[],"bids":[],
+		"ts":"1597026383285","checksum":0,"prevSeqId":123461,"seqId":123461}]}`
+
+	OTHER_INSTRUMENT = `{"arg":{"channel":"books","instId":"ETH-USDT"},"action":"update","data":[{
+		"asks":[["1650.1","1","0","1"]],"bids":[],
+		"ts":"1597026383385","checksum":0,"prevSeqId":5,"seqId":6}]}`
+
+	SUBSCRIBED = `{"event":"subscribe","arg":{"channel":"books","instId":"BTC-USDT"},"connId":"a4d3ae55"}`
+)
+
+func TestParse(t *testing.T) {
+	p := &parser{scale: SCALE, instId: "BTC-USDT"}
+
+	updates, err := p.parse([]byte(SNAPSHOT), 1597026383090)
+	if err != nil || len(updates) != 1 || updates[0].Snapshot == nil {
+		t.Fatalf("snapshot: %v, %v", updates, err)
+	}
+
+	want := orderbook.OrderBook{
+		Time:        1597026383085,
+		UpdateId:    123456,
+		ReceiveTime: 1597026383090,
+		Scale:       SCALE,
+		Bids:        orderbook.DepthLevel{847690: 25000000},
+		Asks:        orderbook.DepthLevel{847698: 41500000000, 847700: 700000000},
+	}
+	if !reflect.DeepEqual(*updates[0].Snapshot, want) {
+		t.Errorf("snapshot %+v, want %+v", *updates[0].Snapshot, want)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		want    *orderbook.DepthDiff
+	}{
+		{"update", UPDATE, &orderbook.DepthDiff{
+			Time:          1597026383185,
+			FirstUpdateId: 123457,
+			LastUpdateId:  123461,
+			ReceiveTime:   1,
+			Bids:          orderbook.DepthLevel{847650: 150000000},
+			Asks:          orderbook.DepthLevel{847700: 0},
+		}},
+		// FirstUpdateId is past LastUpdateId, so the miner skips it
+		{"update with a repeated seqId", UPDATE_WITHOUT_CHANGES, &orderbook.DepthDiff{
+			Time:          1597026383285,
+			FirstUpdateId: 123462,
+			LastUpdateId:  123461,
+			ReceiveTime:   1,
+			Bids:          orderbook.DepthLevel{},
+			Asks:          orderbook.DepthLevel{},
+		}},
+		{"update of another instrument", OTHER_INSTRUMENT, nil},
+		{"subscription reply", SUBSCRIBED, nil},
+		{"reply to a ping", "pong", nil},
+	}
+
+	for _, test := range tests {
+		updates, err := p.parse([]byte(test.message), 1)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if test.want == nil {
+			if len(updates) != 0 {
+				t.Errorf("%s: %v, want no updates", test.name, updates)
+			}
+			continue
+		}
+
+		if len(updates) != 1 || updates[0].Snapshot != nil || !reflect.DeepEqual(updates[0].Diff, *test.want) {
+			t.Errorf("%s: %+v, want %+v", test.name, updates, *test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	p := &parser{scale: SCALE, instId: "BTC-USDT"}
+
+	for _, message := range []string{
+		`{"event":"error","code":"60012","msg":"Invalid request"}`,
+		`{"arg":{"channel":"books"`,
+		`{"arg":{"channel":"books","instId":"BTC-USDT"},"action":"update","data":[{"asks":[],"bids":[],"ts":"now","prevSeqId":1,"seqId":2}]}`,
+		`{"arg":{"channel":"books","instId":"BTC-USDT"},"action":"update","data":[{"asks":[["8477"]],"bids":[],"ts":"1597026383185","prevSeqId":1,"seqId":2}]}`,
+	} {
+		if _, err := p.parse([]byte(message), 1); err == nil {
+			t.Errorf("%s parsed", message)
+		}
+	}
+}
@@ -5,26 +5,39 @@ import (
 	"log"
 	"os"
 
-	"github.com/crypto_pickle/cmd/dataminer/binance"
 	"github.com/crypto_pickle/internal/orderbook"
 	"github.com/crypto_pickle/internal/s3_client"
 )
 
+// MINER_VERSION is recorded in the header of every file. Set it at build time
+// with -ldflags "-X github.com/crypto_pickle/cmd/dataminer/packager.MINER_VERSION=..."
+var MINER_VERSION = "dev"
+
 type Packager struct {
-	histChan       chan orderbook.OrderBookHistory
-	s3_client      *s3_client.S3Client
-	local          string
-	format         string
-	binance_client *binance.BinanceClient
+	histChan    chan orderbook.OrderBookHistory
+	s3_client   *s3_client.S3Client
+	local       string
+	format      string
+	compression string
+	level       int
 }
 
-func New(bufferLength int, s3 *s3_client.S3Client, local string, format string, binance *binance.BinanceClient) Packager {
+func New(bufferLength int, s3 *s3_client.S3Client, local string, format string, compression string, level int) Packager {
+	if _, err := orderbook.GetCodec(format); err != nil {
+		log.Fatal(err)
+	}
+
+	if compression == "" {
+		compression = orderbook.COMPRESSION_NONE
+	}
+
 	return Packager{
-		histChan:       make(chan orderbook.OrderBookHistory, bufferLength),
-		s3_client:      s3,
-		local:          local,
-		format:         format,
-		binance_client: binance,
+		histChan:    make(chan orderbook.OrderBookHistory, bufferLength),
+		s3_client:   s3,
+		local:       local,
+		format:      format,
+		compression: compression,
+		level:       level,
 	}
 }
 
@@ -33,12 +46,14 @@ func (packager *Packager) Start() {
 		for {
 			newHist := <-packager.histChan
 
-			var bytes []byte
-			if packager.format == "json" {
-				bytes = orderbook.HistToJson(newHist)
-			}
+			header := orderbook.NewFileHeader(newHist, packager.format, MINER_VERSION)
+			header.Compression, header.CompressionLevel = packager.compression, packager.level
+			bytes := orderbook.EncodeFile(newHist, header)
 
 			name := fmt.Sprintf("%s/%d-%d.%s", newHist.Symbol, newHist.GetStartTime(), newHist.GetEndTime(), packager.format)
+			if ext := orderbook.CompressionExtension(packager.compression); ext != "" {
+				name += "." + ext
+			}
 
 			if packager.s3_client != nil {
 				go func() {
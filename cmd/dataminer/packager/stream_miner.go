@@ -1,85 +1,351 @@
 package packager
 
 import (
+	"errors"
 	"log"
-	"strings"
 	"time"
 
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
 	"github.com/crypto_pickle/internal/orderbook"
 )
 
 var (
 	ORDERBOOK_FRAMES  = 10 * 60 * 5
 	CHANGEOVER_FRAMES = 10 * 5
-	WS_RESET          = (time.Hour * 23) + (time.Minute * 55)
+	KEYFRAME_FRAMES   = 10 * 30
 )
 
-func Configure(obFrames int, cFrames int) {
+const (
+	RETRY_MIN_DELAY = time.Second
+	RETRY_MAX_DELAY = time.Minute
+)
+
+func Configure(obFrames int, cFrames int, kFrames int) {
 	ORDERBOOK_FRAMES = obFrames
 	CHANGEOVER_FRAMES = cFrames
+	KEYFRAME_FRAMES = kFrames
 }
 
-func (packager *Packager) StartStreamMiner(symbol string, depth int32) {
-	ticker := time.NewTicker(WS_RESET)
+// streamMiner keeps a local copy of the book of a symbol in sync with an
+// exchange and cuts it into histories of about ORDERBOOK_FRAMES frames. See
+// exchange.Exchange for how diffs continue a book, this is the procedure of
+// https://binance-docs.github.io/apidocs/spot/en/#how-to-manage-a-local-order-book-correctly
+// which the adapters of other exchanges map onto.
+//
+// A gap in the update ids means diffs were lost and every book after it would
+// be wrong, so the history is cut at its last correct frame, the gap is
+// recorded in its header and a new history is started from a new snapshot.
+//
+// Exchanges with REST snapshots (binance) start each history from a fresh
+// snapshot, the others send one at the start of every stream, so histories
+// after the first continue from the local book.
+type streamMiner struct {
+	exchange exchange.Exchange
+	packager *Packager
+	symbol   string
+	depth    int32
+
+	// restSnapshots is false if the exchange only sends snapshots in its
+	// streams, see exchange.ErrNoSnapshot
+	restSnapshots bool
+
+	updates chan exchange.Update
+	done    chan struct{}
+
+	// synced is false until the first snapshot of a stream for exchanges
+	// without rest snapshots
+	synced bool
+
+	// snapshot is the start of the current history and book the local book
+	// after its last diff. next is the snapshot of the following history once
+	// fetched during the changeover.
+	snapshot orderbook.OrderBook
+	book     orderbook.OrderBook
+	next     *orderbook.OrderBook
+
+	history      []orderbook.DepthDiff
+	lastUpdateId int64
+
+	// streamed is set once lastUpdateId is that of a diff rather than of the
+	// snapshot, from then on diffs with a PrevUpdateId must name it. Before,
+	// the diff after the one ending at the snapshot names it as well.
+	streamed bool
+
+	// pendingGap is a gap of a history too short to be stored, it is recorded
+	// in the next history instead
+	pendingGap *orderbook.Gap
 
+	// nextBackoff spaces out snapshots of the changeover after failures
+	nextBackoff backoff
+}
+
+// backoff doubles the delay between retries of a failing request, from
+// RETRY_MIN_DELAY up to RETRY_MAX_DELAY.
+type backoff struct {
+	delay time.Duration
+	next  time.Time
+}
+
+func (b *backoff) ready() bool {
+	return !time.Now().Before(b.next)
+}
+
+// failed schedules the next retry, returning its delay.
+func (b *backoff) failed() time.Duration {
+	b.delay *= 2
+	if b.delay < RETRY_MIN_DELAY {
+		b.delay = RETRY_MIN_DELAY
+	} else if b.delay > RETRY_MAX_DELAY {
+		b.delay = RETRY_MAX_DELAY
+	}
+
+	b.next = time.Now().Add(b.delay)
+	return b.delay
+}
+
+func (b *backoff) reset() {
+	*b = backoff{}
+}
+
+// retry calls f until it succeeds. A miner that can't reach its exchange
+// waits, so the miners of other symbols and exchanges keep running.
+func retry(what string, f func() error) {
+	var b backoff
+	for {
+		err := f()
+		if err == nil {
+			return
+		}
+
+		delay := b.failed()
+		log.Printf("Failed to %s, retrying in %s: %s \n", what, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+func (packager *Packager) StartStreamMiner(ex exchange.Exchange, symbol string, depth int32) {
 	go func() {
-		counter := 0
-		history := make([]orderbook.DepthDiff, ORDERBOOK_FRAMES)
+		miner := &streamMiner{
+			exchange: ex,
+			packager: packager,
+			symbol:   symbol,
+			depth:    depth,
+		}
 
-		diffStream, done := packager.binance_client.SubscribeDepthDiffStream(strings.ToLower(symbol))
-		currentOrderBook := packager.binance_client.GetOrderBook(strings.ToUpper(symbol), depth)
+		miner.run()
+	}()
+}
 
-		diff := <-diffStream
-		for diff.FirstUpdateId < currentOrderBook.LastUpdateId {
-			diff = <-diffStream
+func (miner *streamMiner) run() {
+	miner.subscribe()
+
+	var snapshot orderbook.OrderBook
+	var err error
+	retry("get snapshot of "+miner.symbol, func() error {
+		snapshot, err = miner.exchange.Snapshot(miner.symbol, miner.depth)
+		if errors.Is(err, exchange.ErrNoSnapshot) {
+			return nil
 		}
 
-		for {
-			history[counter] = diff.ToDepthDiff()
-			counter += 1
+		return err
+	})
 
-			diff = <-diffStream
+	if err != nil {
+		log.Printf("Waiting for the snapshot of %s in its %s stream \n", miner.symbol, miner.exchange.Name())
+	} else {
+		miner.restSnapshots = true
+		miner.start(snapshot)
+	}
 
-			if counter == ORDERBOOK_FRAMES-CHANGEOVER_FRAMES {
-				newOrderBook := packager.binance_client.GetOrderBook(strings.ToUpper(symbol), depth)
-				newHistory := make([]orderbook.DepthDiff, ORDERBOOK_FRAMES)
+	for {
+		update, ok := <-miner.updates
+		if !ok {
+			miner.closed()
+			continue
+		}
 
-				for {
-					if diff.FirstUpdateId < newOrderBook.LastUpdateId && counter < len(history) {
-						history[counter] = diff.ToDepthDiff()
-						counter += 1
+		miner.apply(update)
+	}
+}
 
-						diff = <-diffStream
-					} else {
-						newHistory[0] = diff.ToDepthDiff()
+func (miner *streamMiner) subscribe() {
+	retry("subscribe to "+miner.symbol+" on "+miner.exchange.Name(), func() error {
+		var err error
+		miner.updates, miner.done, err = miner.exchange.Subscribe(miner.symbol, miner.depth)
+		return err
+	})
+}
 
-						ob := currentOrderBook.ToOrderBook()
+// resync starts a new history from a new snapshot.
+func (miner *streamMiner) resync() {
+	if !miner.restSnapshots {
+		close(miner.done)
+		miner.synced = false
+		miner.subscribe()
+		return
+	}
 
-						packager.histChan <- orderbook.OrderBookHistory{
-							Symbol:  symbol,
-							Start:   ob.ApplyDepthDiff(history[0]),
-							History: history[1:counter],
-						}
+	var snapshot orderbook.OrderBook
+	retry("get snapshot of "+miner.symbol, func() error {
+		var err error
+		snapshot, err = miner.exchange.Snapshot(miner.symbol, miner.depth)
+		return err
+	})
 
-						currentOrderBook = newOrderBook
-						history = newHistory
+	miner.start(snapshot)
+}
 
-						counter = 1
+// closed reconnects after a stream failed. A new stream of an exchange
+// without rest snapshots starts from a new snapshot, so the updates in
+// between are lost. Otherwise the update ids tell whether anything was.
+func (miner *streamMiner) closed() {
+	log.Printf("Depth stream of %s closed, reconnecting \n", miner.symbol)
 
-						break
-					}
-				}
+	if !miner.restSnapshots && miner.synced {
+		miner.emit(miner.history, &orderbook.Gap{Time: time.Now().UnixMilli(), LastUpdateId: miner.lastUpdateId})
+		miner.synced = false
+	}
 
-				select {
-				case <-ticker.C:
-					done <- struct{}{}
-					diffStream, done = packager.binance_client.SubscribeDepthDiffStream(symbol)
+	miner.subscribe()
+}
 
-					log.Printf("Reset Peer Connection for symbol %s \n", symbol)
-				default:
-					continue
-				}
-			}
+// start begins a new history from snapshot, ending the current one.
+func (miner *streamMiner) start(snapshot orderbook.OrderBook) {
+	if miner.synced {
+		miner.emit(miner.history, nil)
+	}
+
+	miner.snapshot, miner.book, miner.next = snapshot, snapshot.Copy(), nil
+	miner.history = make([]orderbook.DepthDiff, 0, ORDERBOOK_FRAMES)
+	miner.lastUpdateId = snapshot.UpdateId
+	miner.streamed = false
+	miner.synced = true
+}
+
+// apply applies an update to the current history, syncing the book again if
+// it didn't continue the stream. Diffs already applied are skipped, the first
+// diffs of a stream are usually older than the snapshot it is synced from.
+func (miner *streamMiner) apply(update exchange.Update) {
+	if update.Snapshot != nil {
+		miner.start(*update.Snapshot)
+		return
+	}
+
+	diff := update.Diff
+	if !miner.synced || diff.LastUpdateId <= miner.lastUpdateId {
+		return
+	}
+
+	continues := diff.FirstUpdateId <= miner.lastUpdateId+1
+	if update.PrevUpdateId != 0 && (miner.streamed || update.PrevUpdateId == miner.lastUpdateId) {
+		continues = update.PrevUpdateId == miner.lastUpdateId
+	}
+
+	if !continues {
+		gap := &orderbook.Gap{Time: diff.Time, LastUpdateId: miner.lastUpdateId, NextUpdateId: diff.FirstUpdateId}
+		log.Printf("Gap in depth stream of %s: expected update %d, got %d. Syncing from a new snapshot \n", miner.symbol, gap.LastUpdateId+1, gap.NextUpdateId)
+
+		miner.emit(miner.history, gap)
+		miner.synced = false
+		miner.resync()
+
+		return
+	}
+
+	miner.history = append(miner.history, diff)
+	miner.book.ApplyDepthDiff(diff)
+	miner.lastUpdateId = diff.LastUpdateId
+	miner.streamed = true
+
+	if len(miner.history) >= ORDERBOOK_FRAMES-CHANGEOVER_FRAMES {
+		miner.changeover()
+	}
+}
+
+// changeover starts the next history. With rest snapshots it waits until the
+// stream has passed the snapshot the next history is built from, the current
+// one ends with the last diff the snapshot already contains. Otherwise the
+// next history starts from the local book. A failed snapshot is retried with
+// a later diff, the current history keeps growing meanwhile.
+func (miner *streamMiner) changeover() {
+	if !miner.restSnapshots {
+		next := miner.book.Copy()
+
+		miner.emit(miner.history, nil)
+		miner.synced = false
+		miner.start(next)
+
+		return
+	}
+
+	if miner.next == nil {
+		if !miner.nextBackoff.ready() {
+			return
 		}
-	}()
+
+		snapshot, err := miner.exchange.Snapshot(miner.symbol, miner.depth)
+		if err != nil {
+			log.Printf("Failed to get snapshot of %s, retrying in %s: %s \n", miner.symbol, miner.nextBackoff.failed(), err)
+			return
+		}
+
+		miner.next = &snapshot
+		miner.nextBackoff.reset()
+	}
+
+	if miner.lastUpdateId <= miner.next.UpdateId {
+		return
+	}
+
+	i := 0
+	for miner.history[i].LastUpdateId <= miner.next.UpdateId {
+		i++
+	}
+
+	// the first diff of a history is applied to its snapshot to get its
+	// start, so a snapshot older than that can't start the next history
+	if i == 0 {
+		log.Printf("Snapshot %d of %s is older than its history, refetching \n", miner.next.UpdateId, miner.symbol)
+		miner.next = nil
+		return
+	}
+
+	miner.emit(miner.history[:i], nil)
+
+	next := *miner.next
+	miner.snapshot, miner.next = next, nil
+	miner.history = append(make([]orderbook.DepthDiff, 0, ORDERBOOK_FRAMES), miner.history[i:]...)
+}
+
+// emit sends a history to the packager. A history needs at least one diff
+// after its start, shorter ones are dropped and their gap, if any, is recorded
+// as the GapBefore of the next history. Gaps of consecutive dropped histories
+// are merged into one spanning all of them.
+func (miner *streamMiner) emit(history []orderbook.DepthDiff, gap *orderbook.Gap) {
+	if len(history) < 2 {
+		log.Printf("Dropping history of %s with %d frames \n", miner.symbol, len(history))
+
+		if gap != nil && miner.pendingGap != nil {
+			miner.pendingGap = &orderbook.Gap{Time: gap.Time, LastUpdateId: miner.pendingGap.LastUpdateId, NextUpdateId: gap.NextUpdateId}
+		} else if gap != nil {
+			miner.pendingGap = gap
+		}
+
+		return
+	}
+
+	start := miner.snapshot.Copy()
+
+	hist := orderbook.OrderBookHistory{
+		Symbol:           miner.exchange.StorageSymbol(miner.symbol),
+		Start:            start.ApplyDepthDiff(history[0]),
+		SnapshotUpdateId: miner.snapshot.UpdateId,
+		Gap:              gap,
+		GapBefore:        miner.pendingGap,
+		History:          history[1:],
+	}
+	miner.pendingGap = nil
+	hist.BuildKeyframes(KEYFRAME_FRAMES)
+
+	miner.packager.histChan <- hist
 }
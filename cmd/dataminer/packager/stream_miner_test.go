@@ -0,0 +1,332 @@
+package packager
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/crypto_pickle/cmd/dataminer/exchange"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// fakeExchange serves its snapshots in order, repeating the last one, or
+// none if it has none. Every subscription is a new stream the test feeds by
+// calling apply.
+type fakeExchange struct {
+	snapshots     []orderbook.OrderBook
+	fetched       int
+	subscriptions int
+}
+
+func (ex *fakeExchange) Name() string                          { return "fake" }
+func (ex *fakeExchange) NormalizeSymbol(symbol string) string  { return symbol }
+func (ex *fakeExchange) StorageSymbol(symbol string) string    { return "fake-" + symbol }
+func (ex *fakeExchange) Scale(string) (orderbook.Scale, error) { return orderbook.Scale{}, nil }
+func (ex *fakeExchange) Limits() exchange.Limits               { return exchange.Limits{} }
+
+func (ex *fakeExchange) Snapshot(string, int32) (orderbook.OrderBook, error) {
+	if ex.snapshots == nil {
+		return orderbook.OrderBook{}, exchange.ErrNoSnapshot
+	}
+
+	i := ex.fetched
+	if i >= len(ex.snapshots) {
+		i = len(ex.snapshots) - 1
+	}
+	ex.fetched++
+
+	return ex.snapshots[i].Copy(), nil
+}
+
+func (ex *fakeExchange) Subscribe(string, int32) (chan exchange.Update, chan struct{}, error) {
+	ex.subscriptions++
+	return make(chan exchange.Update), make(chan struct{}), nil
+}
+
+// newTestMiner returns a miner subscribed to ex, synced from its first
+// snapshot if it has snapshots.
+func newTestMiner(ex *fakeExchange) *streamMiner {
+	miner := &streamMiner{
+		exchange:      ex,
+		packager:      &Packager{histChan: make(chan orderbook.OrderBookHistory, 100)},
+		symbol:        "btcusdt",
+		depth:         10,
+		restSnapshots: ex.snapshots != nil,
+	}
+
+	miner.subscribe()
+	if miner.restSnapshots {
+		miner.resync()
+	}
+
+	return miner
+}
+
+// histories returns the histories the miner emitted so far.
+func histories(miner *streamMiner) []orderbook.OrderBookHistory {
+	res := make([]orderbook.OrderBookHistory, 0)
+	for {
+		select {
+		case hist := <-miner.packager.histChan:
+			res = append(res, hist)
+		default:
+			return res
+		}
+	}
+}
+
+func testSnapshot(updateId int64) orderbook.OrderBook {
+	return orderbook.OrderBook{
+		Time:     updateId,
+		UpdateId: updateId,
+		Bids:     orderbook.DepthLevel{100: 1},
+		Asks:     orderbook.DepthLevel{101: 1},
+	}
+}
+
+// testDiff returns a diff from first to last, with its last update id as its
+// time and bid quantity so the frames of a history tell their diffs apart.
+func testDiff(first, last int64) exchange.Update {
+	return exchange.Update{Diff: orderbook.DepthDiff{
+		Time:          last,
+		FirstUpdateId: first,
+		LastUpdateId:  last,
+		Bids:          orderbook.DepthLevel{100: last},
+		Asks:          orderbook.DepthLevel{},
+	}}
+}
+
+// testFuturesDiff returns a diff of a stream whose update ids aren't
+// consecutive, e.g. binance futures.
+func testFuturesDiff(first, last, prev int64) exchange.Update {
+	update := testDiff(first, last)
+	update.PrevUpdateId = prev
+
+	return update
+}
+
+func TestApplyPrevUpdateId(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []exchange.Update
+		history int   // diffs of the current history
+		gap     int64 // NextUpdateId of the gap of an emitted history, 0 if none
+	}{
+		{"diff ending at the snapshot, then one continuing it", []exchange.Update{
+			testFuturesDiff(90, 100, 80),
+			testFuturesDiff(120, 130, 100),
+			testFuturesDiff(140, 150, 130),
+		}, 2, 0},
+		{"diff straddling the snapshot", []exchange.Update{
+			testFuturesDiff(95, 105, 90),
+			testFuturesDiff(120, 130, 105),
+		}, 2, 0},
+		{"first diff after the snapshot", []exchange.Update{
+			testFuturesDiff(101, 110, 100),
+		}, 1, 0},
+		{"first diff past the snapshot", []exchange.Update{
+			testFuturesDiff(120, 130, 110),
+		}, 0, 120},
+		{"diff not continuing the one before", []exchange.Update{
+			testFuturesDiff(95, 105, 90),
+			testFuturesDiff(110, 115, 105),
+			testFuturesDiff(120, 130, 116),
+			testFuturesDiff(131, 140, 130),
+		}, 0, 120},
+	}
+
+	ORDERBOOK_FRAMES, CHANGEOVER_FRAMES = 100, 10
+	defer Configure(10*60*5, 10*5, 10*30)
+
+	for _, test := range tests {
+		ex := &fakeExchange{snapshots: []orderbook.OrderBook{testSnapshot(100), testSnapshot(1000)}}
+		miner := newTestMiner(ex)
+
+		for _, update := range test.updates {
+			miner.apply(update)
+		}
+
+		hists := histories(miner)
+		if test.gap == 0 {
+			if len(hists) != 0 || ex.fetched != 1 || len(miner.history) != test.history {
+				t.Errorf("%s: %d histories, %d snapshots, %d diffs, want 0, 1, %d", test.name, len(hists), ex.fetched, len(miner.history), test.history)
+			}
+			continue
+		}
+
+		if ex.fetched != 2 || miner.snapshot.UpdateId != 1000 || len(miner.history) != test.history {
+			t.Errorf("%s: %d snapshots, synced from %d with %d diffs, want a resync from 1000", test.name, ex.fetched, miner.snapshot.UpdateId, len(miner.history))
+		}
+
+		// a history of fewer than 2 diffs is dropped and its gap recorded
+		// before the next one
+		if gap := miner.pendingGap; len(hists) == 0 && (gap == nil || gap.NextUpdateId != test.gap) {
+			t.Errorf("%s: pending gap %+v, want one before %d", test.name, gap, test.gap)
+		}
+
+		if len(hists) == 1 && (hists[0].Gap == nil || hists[0].Gap.NextUpdateId != test.gap) {
+			t.Errorf("%s: gap %+v, want one before %d", test.name, hists[0].Gap, test.gap)
+		}
+	}
+}
+
+// emitted is what a test checks of an emitted history.
+type emitted struct {
+	snapshot  int64 // SnapshotUpdateId
+	frames    int
+	gap       *orderbook.Gap
+	gapBefore *orderbook.Gap
+}
+
+func TestApply(t *testing.T) {
+	snapshot := func(updateId int64) exchange.Update {
+		ob := testSnapshot(updateId)
+		return exchange.Update{Snapshot: &ob}
+	}
+
+	tests := []struct {
+		name string
+
+		// snapshots of the exchange, or nil if it sends them in its stream
+		snapshots []int64
+		frames    int
+		updates   []exchange.Update
+
+		want []emitted
+		// UpdateId of the snapshot the current history starts from and its
+		// number of diffs
+		snapshot int64
+		history  int
+	}{
+		{
+			name:      "diffs older than the snapshot are skipped",
+			snapshots: []int64{10},
+			updates:   []exchange.Update{testDiff(5, 8), testDiff(9, 10), testDiff(10, 11), testDiff(12, 12), testDiff(11, 12)},
+			snapshot:  10,
+			history:   2,
+		},
+		{
+			name:      "gap ends the history and syncs from a new snapshot",
+			snapshots: []int64{10, 100},
+			updates:   []exchange.Update{testDiff(11, 11), testDiff(12, 12), testDiff(13, 13), testDiff(15, 15), testDiff(14, 101)},
+			want: []emitted{
+				{snapshot: 10, frames: 2, gap: &orderbook.Gap{Time: 15, LastUpdateId: 13, NextUpdateId: 15}},
+			},
+			snapshot: 100,
+			history:  1,
+		},
+		{
+			name:      "changeover ends the history at the next snapshot",
+			snapshots: []int64{10, 12},
+			frames:    6,
+			updates:   []exchange.Update{testDiff(11, 11), testDiff(12, 12), testDiff(13, 13), testDiff(14, 14)},
+			want: []emitted{
+				{snapshot: 10, frames: 1},
+			},
+			snapshot: 12,
+			history:  2,
+		},
+		{
+			name:      "changeover refetches a snapshot older than the history",
+			snapshots: []int64{10, 10, 13},
+			frames:    6,
+			updates:   []exchange.Update{testDiff(11, 11), testDiff(12, 12), testDiff(13, 13), testDiff(14, 14), testDiff(15, 15)},
+			want: []emitted{
+				{snapshot: 10, frames: 2},
+			},
+			snapshot: 13,
+			history:  2,
+		},
+		{
+			name:      "gaps of dropped short histories are merged into the next",
+			snapshots: []int64{10, 20, 30},
+			updates: []exchange.Update{
+				testDiff(11, 11), testDiff(13, 13),
+				testDiff(21, 21), testDiff(23, 23),
+				testDiff(31, 31), testDiff(32, 32), testDiff(33, 33), testDiff(35, 35),
+			},
+			want: []emitted{
+				{
+					snapshot:  30,
+					frames:    2,
+					gap:       &orderbook.Gap{Time: 35, LastUpdateId: 33, NextUpdateId: 35},
+					gapBefore: &orderbook.Gap{Time: 23, LastUpdateId: 11, NextUpdateId: 23},
+				},
+			},
+			snapshot: 30,
+		},
+		{
+			name: "stream snapshots",
+			updates: []exchange.Update{
+				testDiff(1, 1), snapshot(10), testDiff(11, 11), testDiff(12, 12), testDiff(13, 13),
+				testDiff(15, 15), testDiff(16, 16), snapshot(50), testDiff(51, 51),
+			},
+			want: []emitted{
+				{snapshot: 10, frames: 2, gap: &orderbook.Gap{Time: 15, LastUpdateId: 13, NextUpdateId: 15}},
+			},
+			snapshot: 50,
+			history:  1,
+		},
+		{
+			name:    "stream snapshots continue from the local book at the changeover",
+			frames:  6,
+			updates: []exchange.Update{snapshot(10), testDiff(11, 11), testDiff(12, 12), testDiff(13, 13), testDiff(14, 14), testDiff(15, 15)},
+			want: []emitted{
+				{snapshot: 10, frames: 3},
+			},
+			snapshot: 14,
+			history:  1,
+		},
+	}
+
+	defer Configure(10*60*5, 10*5, 10*30)
+
+	for _, test := range tests {
+		ORDERBOOK_FRAMES, CHANGEOVER_FRAMES = 100, 10
+		if test.frames > 0 {
+			ORDERBOOK_FRAMES, CHANGEOVER_FRAMES = test.frames, 2
+		}
+
+		ex := &fakeExchange{}
+		for _, updateId := range test.snapshots {
+			ex.snapshots = append(ex.snapshots, testSnapshot(updateId))
+		}
+		miner := newTestMiner(ex)
+
+		for _, update := range test.updates {
+			miner.apply(update)
+		}
+
+		got := make([]emitted, 0)
+		for _, hist := range histories(miner) {
+			got = append(got, emitted{snapshot: hist.SnapshotUpdateId, frames: len(hist.History), gap: hist.Gap, gapBefore: hist.GapBefore})
+
+			// the start of a history is its snapshot with its first diff
+			// applied, every frame after is one of the stream
+			if hist.Start.Bids[100] != hist.Start.UpdateId || hist.GetEndTime() != hist.History[len(hist.History)-1].LastUpdateId {
+				t.Errorf("%s: history from %d doesn't follow its diffs", test.name, hist.SnapshotUpdateId)
+			}
+		}
+
+		if test.want == nil {
+			test.want = []emitted{}
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: emitted %s, want %s", test.name, describe(got), describe(test.want))
+		}
+
+		if miner.snapshot.UpdateId != test.snapshot || len(miner.history) != test.history {
+			t.Errorf("%s: history from %d with %d diffs, want from %d with %d", test.name, miner.snapshot.UpdateId, len(miner.history), test.snapshot, test.history)
+		}
+	}
+}
+
+func describe(hists []emitted) string {
+	res := ""
+	for _, hist := range hists {
+		res += fmt.Sprintf("{%d %d %+v %+v}", hist.snapshot, hist.frames, hist.gap, hist.gapBefore)
+	}
+
+	return "[" + res + "]"
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/crypto_pickle/internal/export"
+)
+
+func arrowCommand(args []string) {
+	flags := flag.NewFlagSet("arrow", flag.ExitOnError)
+	src := addSourceFlags(flags)
+	sel := addSelectionFlags(flags)
+	long := flags.Bool("long", false, "write one row per level instead of one row per frame")
+	out := flags.String("out", "-", "file to write, - for stdout")
+	flags.Parse(args)
+
+	layout := export.LAYOUT_WIDE
+	if *long {
+		layout = export.LAYOUT_LONG
+	}
+
+	output := createOutput(*out)
+	defer output.Close()
+
+	w, err := export.NewArrowWriter(output, layout, *sel.depth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exportFrames(src, sel, w)
+}
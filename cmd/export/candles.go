@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/crypto_pickle/internal/analytics"
+	"github.com/crypto_pickle/internal/export"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+var candleColumns = "time,open,high,low,close,frames,spread_mean,spread_min,spread_max"
+
+// candlesCommand writes OHLC candles of a price series, e.g.
+//
+//	export candles -dir data -symbol btcusdt -start 2023-06-01 -end 2023-06-08 -interval 1h -source microprice
+func candlesCommand(args []string) {
+	flags := flag.NewFlagSet("candles", flag.ExitOnError)
+	src := addSourceFlags(flags)
+	interval_flag := flags.String("interval", "1m", "length of a candle between 1s and 1d, e.g. 1s, 5m, 4h or 1d")
+	source_flag := flags.String("source", "mid", "price series of the candles: mid, microprice, bid or ask")
+	ndjson := flags.Bool("ndjson", false, "write newline delimited JSON instead of CSV")
+	out := flags.String("out", "-", "file to write, - for stdout")
+	flags.Parse(args)
+
+	interval, err := analytics.ParseInterval(*interval_flag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	source, err := analytics.ParseCandleSource(*source_flag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store := src.store()
+	start, end := src.timeRange()
+
+	output := createOutput(*out)
+	defer output.Close()
+
+	w := bufio.NewWriter(output)
+	if !*ndjson {
+		fmt.Fprintln(w, candleColumns)
+	}
+
+	count := 0
+	write := func(candles []analytics.Candle) error {
+		for _, candle := range candles {
+			if err := writeCandle(w, candle, *ndjson); err != nil {
+				return err
+			}
+		}
+
+		count += len(candles)
+		return nil
+	}
+
+	// only the best level of each side is needed
+	builder := analytics.NewCandleBuilder(interval, source)
+	err = export.Frames(store, *src.symbol, start, end, 1, 10, func(obs []orderbook.OrderBookSmall) error {
+		return write(builder.Add(obs))
+	})
+	if err == nil {
+		err = write(builder.Flush())
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Exported %d candles of %s \n", count, *src.symbol)
+}
+
+func writeCandle(w *bufio.Writer, candle analytics.Candle, ndjson bool) error {
+	if ndjson {
+		line, err := json.Marshal(candle)
+		if err != nil {
+			return err
+		}
+
+		w.Write(line)
+		return w.WriteByte('\n')
+	}
+
+	buf := make([]byte, 0, 128)
+	buf = strconv.AppendInt(buf, candle.Time, 10)
+	for _, v := range []float64{candle.Open, candle.High, candle.Low, candle.Close} {
+		buf = append(buf, ',')
+		buf = strconv.AppendFloat(buf, v, 'f', -1, 64)
+	}
+
+	buf = append(buf, ',')
+	buf = strconv.AppendInt(buf, int64(candle.Frames), 10)
+	for _, v := range []float64{candle.SpreadMean, candle.SpreadMin, candle.SpreadMax} {
+		buf = append(buf, ',')
+		buf = strconv.AppendFloat(buf, v, 'f', -1, 64)
+	}
+
+	buf = append(buf, '\n')
+	_, err := w.Write(buf)
+	return err
+}
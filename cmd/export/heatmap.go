@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+
+	"github.com/crypto_pickle/internal/export"
+	"github.com/crypto_pickle/internal/heatmap"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// heatmapCommand renders a PNG of the liquidity of a book over time, e.g.
+//
+//	export heatmap -dir data -symbol btcusdt -start 2023-06-01T12:00:00 -end 2023-06-01T12:30:00 -low 26800 -high 27200 -out incident.png
+func heatmapCommand(args []string) {
+	flags := flag.NewFlagSet("heatmap", flag.ExitOnError)
+	src := addSourceFlags(flags)
+	low := flags.Float64("low", 0, "lowest price shown")
+	high := flags.Float64("high", 0, "highest price shown")
+	width := flags.Int("width", 1200, "width of the image in pixels, one column per time slice")
+	height := flags.Int("height", 600, "height of the image in pixels, one row per price bucket")
+	freq := flags.Int("freq", 10, "frames per second to read, either 10 or 1")
+	out := flags.String("out", "heatmap.png", "file to write, - for stdout")
+	flags.Parse(args)
+
+	if *freq != 10 && *freq != 1 {
+		log.Fatal("-freq can only be 10 or 1")
+	}
+
+	store := src.store()
+	start, end := src.timeRange()
+	if start == 0 || end == 0 {
+		log.Fatal("-start and -end are required")
+	}
+
+	h, err := heatmap.New(start, end, *low, *high, *width, *height)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// every level inside [low, high] may be needed
+	err = export.Frames(store, *src.symbol, start, end, orderbook.MAX_DEPTH, *freq, func(obs []orderbook.OrderBookSmall) error {
+		h.Add(obs)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output := createOutput(*out)
+	defer output.Close()
+
+	w := bufio.NewWriter(output)
+	if err := h.Encode(w); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Rendered heatmap of %s to %s \n", *src.symbol, *out)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/crypto_pickle/cmd/api/utils"
+	"github.com/crypto_pickle/internal/export"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/crypto_pickle/internal/s3_client"
+	"github.com/crypto_pickle/internal/storage"
+)
+
+// export converts mined histories into formats used for research, e.g.
+//
+//	export parquet -dir data -symbol btcusdt -start 2023-06-01 -end 2023-06-02 -depth 10 -out btcusdt.parquet
+//	export csv -bucket datapickles -symbol ethusdt -start 2023-06-01T12:00:00 -end 2023-06-01T12:05:00 -freq 1
+
+var commands = map[string]func(args []string){
+	"arrow":   arrowCommand,
+	"candles": candlesCommand,
+	"csv":     csvCommand,
+	"heatmap": heatmapCommand,
+	"ndjson":  ndjsonCommand,
+	"numpy":   numpyCommand,
+	"parquet": parquetCommand,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		usage()
+	}
+
+	commands[os.Args[1]](os.Args[2:])
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: export <command> [flags], commands: %v \n", names)
+	fmt.Fprintln(os.Stderr, "run export <command> -h for the flags of a command")
+	os.Exit(2)
+}
+
+// source holds the flags every command uses to select the histories to export.
+type source struct {
+	dir    *string
+	bucket *string
+	symbol *string
+	start  *string
+	end    *string
+}
+
+func addSourceFlags(flags *flag.FlagSet) source {
+	return source{
+		dir:    flags.String("dir", "", "local directory to read histories from"),
+		bucket: flags.String("bucket", "", "S3 bucket to read histories from. Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION"),
+		symbol: flags.String("symbol", "", "symbol to export, e.g. btcusdt"),
+		start:  flags.String("start", "", "start of the export as YYYY-MM-DDTHH:mm:ss.d or unix milliseconds, defaults to the first frame"),
+		end:    flags.String("end", "", "end of the export as YYYY-MM-DDTHH:mm:ss.d or unix milliseconds, defaults to the last frame"),
+	}
+}
+
+func (src source) store() storage.Store {
+	if *src.symbol == "" {
+		log.Fatal("-symbol is required")
+	}
+
+	if *src.dir != "" && *src.bucket != "" {
+		log.Fatal("only one of -dir and -bucket can be given")
+	} else if *src.dir != "" {
+		return storage.NewLocal(*src.dir)
+	} else if *src.bucket != "" {
+		client := s3_client.NewClient(
+			s3_client.GetEnvWithKey("AWS_ACCESS_KEY_ID"),
+			s3_client.GetEnvWithKey("AWS_SECRET_ACCESS_KEY"),
+			s3_client.GetEnvWithKey("AWS_REGION"),
+		)
+
+		return storage.NewS3(&client, *src.bucket)
+	}
+
+	log.Fatal("one of -dir and -bucket is required")
+	return nil
+}
+
+func parseTime(s string) int64 {
+	if s == "" {
+		return 0
+	}
+
+	if t, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return t
+	}
+
+	t, err := utils.DateTimeStringToUnixMilli(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return int64(t)
+}
+
+func (src source) timeRange() (int64, int64) {
+	return parseTime(*src.start), parseTime(*src.end)
+}
+
+// selection holds the flags shaping the exported frames.
+type selection struct {
+	depth    *int
+	freq     *int
+	period   *int64
+	resample *string
+}
+
+func addSelectionFlags(flags *flag.FlagSet) selection {
+	return selection{
+		depth:    flags.Int("depth", 10, "levels per side to export"),
+		freq:     flags.Int("freq", 10, "frames per second to export, either 10 or 1"),
+		period:   flags.Int64("period", 0, "resample to one frame every period milliseconds. 0 disables resampling"),
+		resample: flags.String("resample", orderbook.RESAMPLE_LAST, "frame sampled at each tick of -period: last (the book at the tick), first-after or skip-unchanged"),
+	}
+}
+
+// frameWriter is implemented by every writer in internal/export.
+type frameWriter interface {
+	Write(symbol string, obs []orderbook.OrderBookSmall) error
+	Close() error
+}
+
+// exportFrames writes the selected frames of src to w and closes it.
+func exportFrames(src source, sel selection, w frameWriter) {
+	if *sel.freq != 10 && *sel.freq != 1 {
+		log.Fatal("-freq can only be 10 or 1")
+	} else if *sel.period < 0 {
+		log.Fatal("-period can't be negative")
+	} else if *sel.depth <= 0 || *sel.depth > orderbook.MAX_DEPTH {
+		log.Fatalf("-depth must be between 1 and %d", orderbook.MAX_DEPTH)
+	}
+
+	store := src.store()
+	start, end := src.timeRange()
+
+	var resampler *orderbook.Resampler
+	if *sel.period > 0 {
+		var err error
+		if resampler, err = orderbook.NewResampler(start, *sel.period, *sel.resample); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	frames, last := 0, int64(0)
+	write := func(obs []orderbook.OrderBookSmall) error {
+		if resampler != nil {
+			if len(obs) > 0 {
+				last = obs[len(obs)-1].Time
+			}
+			obs = resampler.Add(obs)
+		}
+
+		frames += len(obs)
+		return w.Write(*src.symbol, obs)
+	}
+
+	err := export.Frames(store, *src.symbol, start, end, *sel.depth, *sel.freq, write)
+	if err == nil && resampler != nil {
+		// the book after the last exported frame is unknown, so the grid
+		// stops there rather than at -end
+		obs := resampler.Flush(last)
+		frames += len(obs)
+		err = w.Write(*src.symbol, obs)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Exported %d frames of %s \n", frames, *src.symbol)
+}
+
+// createOutput opens the file to export to, "-" writes to stdout.
+func createOutput(path string) io.WriteCloser {
+	if path == "-" {
+		return os.Stdout
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return file
+}
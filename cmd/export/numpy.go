@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/crypto_pickle/internal/export"
+)
+
+func numpyCommand(args []string) {
+	flags := flag.NewFlagSet("numpy", flag.ExitOnError)
+	src := addSourceFlags(flags)
+	sel := addSelectionFlags(flags)
+	normalize := flags.Bool("normalize", false, "give prices relative to the mid price of their frame, (price - mid) / mid")
+	out := flags.String("out", "-", "file to write, .npy for the books tensor alone, otherwise an .npz archive with times (and mids when normalized). - writes an .npz to stdout")
+	flags.Parse(args)
+
+	npz := !strings.HasSuffix(*out, ".npy")
+
+	output := createOutput(*out)
+	defer output.Close()
+
+	exportFrames(src, sel, export.NewNumpyWriter(output, *sel.depth, npz, *normalize))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/crypto_pickle/internal/export"
+)
+
+func parquetCommand(args []string) {
+	flags := flag.NewFlagSet("parquet", flag.ExitOnError)
+	src := addSourceFlags(flags)
+	sel := addSelectionFlags(flags)
+	long := flags.Bool("long", false, "write one row per level instead of one row per frame")
+	out := flags.String("out", "-", "file to write, - for stdout")
+	flags.Parse(args)
+
+	layout := export.LAYOUT_WIDE
+	if *long {
+		layout = export.LAYOUT_LONG
+	}
+
+	w, err := export.NewParquetWriter(createOutput(*out), layout, *sel.depth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exportFrames(src, sel, w)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/crypto_pickle/internal/export"
+)
+
+func csvCommand(args []string) {
+	flags := flag.NewFlagSet("csv", flag.ExitOnError)
+	src := addSourceFlags(flags)
+	sel := addSelectionFlags(flags)
+	out := flags.String("out", "-", "file to write, - for stdout")
+	flags.Parse(args)
+
+	output := createOutput(*out)
+	defer output.Close()
+
+	w, err := export.NewCSVWriter(output, *sel.depth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	exportFrames(src, sel, w)
+}
+
+func ndjsonCommand(args []string) {
+	flags := flag.NewFlagSet("ndjson", flag.ExitOnError)
+	src := addSourceFlags(flags)
+	sel := addSelectionFlags(flags)
+	out := flags.String("out", "-", "file to write, - for stdout")
+	flags.Parse(args)
+
+	output := createOutput(*out)
+	defer output.Close()
+
+	exportFrames(src, sel, export.NewNDJSONWriter(output))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/crypto_pickle/internal/binanceinfo"
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/crypto_pickle/internal/s3_client"
+	"github.com/crypto_pickle/internal/storage"
+)
+
+// migrate rewrites history files written by older miners to the current file
+// version, either in place or under a new prefix.
+
+var dir = flag.String("dir", "", "local directory to migrate")
+var bucket = flag.String("bucket", "", "S3 bucket to migrate. Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION")
+var prefix = flag.String("prefix", "", "write migrated files under this prefix (e.g. v1/) instead of replacing them")
+var symbol = flag.String("symbol", "", "only migrate files of this symbol")
+var format = flag.String("format", "", "codec of the migrated files ("+strings.Join(orderbook.CodecNames(), ", ")+"), defaults to the codec of each source file")
+var compression = flag.String("compression", "", "compression of the migrated files (none, gzip or zstd), defaults to the compression of each source file")
+var level = flag.Int("level", 0, "compression level of the migrated files, 0 uses the default level")
+var keyframes = flag.Int("keyframes", 10*30, "frames between keyframes in migrated files")
+var priceDecimals = flag.Int("price-decimals", -1, "decimal places of prices in legacy files, looked up on binance if not given")
+var qtyDecimals = flag.Int("qty-decimals", -1, "decimal places of quantities in legacy files, looked up on binance if not given")
+var dryRun = flag.Bool("dry-run", false, "report what would be migrated without writing anything")
+
+var scales = make(map[string]orderbook.Scale)
+
+func main() {
+	flag.Parse()
+
+	if *format != "" {
+		if _, err := orderbook.GetCodec(*format); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	store := openStore()
+
+	listPrefix := ""
+	if *symbol != "" {
+		listPrefix = *symbol + "/"
+	}
+
+	keys, err := store.List(listPrefix)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrated, skipped, failed := 0, 0, 0
+	for _, key := range keys {
+		// files of an earlier migration under the same prefix are already
+		// migrated, and would otherwise be migrated under the prefix twice
+		if *prefix != "" && strings.HasPrefix(key, *prefix) {
+			skipped++
+			continue
+		}
+
+		ok, err := migrate(store, key)
+		if err != nil {
+			log.Printf("failed to migrate %s: %s \n", key, err)
+			failed++
+		} else if ok {
+			migrated++
+		} else {
+			skipped++
+		}
+	}
+
+	log.Printf("Migrated %d files, skipped %d up to date files, %d failed \n", migrated, skipped, failed)
+}
+
+func openStore() storage.Store {
+	if *dir != "" && *bucket != "" {
+		log.Fatal("only one of -dir and -bucket can be given")
+	} else if *dir != "" {
+		return storage.NewLocal(*dir)
+	} else if *bucket != "" {
+		client := s3_client.NewClient(
+			s3_client.GetEnvWithKey("AWS_ACCESS_KEY_ID"),
+			s3_client.GetEnvWithKey("AWS_SECRET_ACCESS_KEY"),
+			s3_client.GetEnvWithKey("AWS_REGION"),
+		)
+
+		return storage.NewS3(&client, *bucket)
+	}
+
+	log.Fatal("one of -dir and -bucket is required")
+	return nil
+}
+
+func getScale(symbol string) (orderbook.Scale, error) {
+	if *priceDecimals >= 0 && *qtyDecimals >= 0 {
+		return orderbook.Scale{PriceDecimals: int32(*priceDecimals), QtyDecimals: int32(*qtyDecimals)}, nil
+	}
+
+	scale, ok := scales[symbol]
+	if !ok {
+		var err error
+		scale, err = binanceinfo.GetSpotScale(strings.ToUpper(symbol))
+		if err != nil {
+			return scale, err
+		}
+		scales[symbol] = scale
+
+		log.Printf("Using scale %+v for %s \n", scale, symbol)
+	}
+
+	return scale, nil
+}
+
+// migrate rewrites a single file, returning false if it was already up to date.
+func migrate(store storage.Store, key string) (bool, error) {
+	srcKey, err := storage.ParseKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := store.Get(key)
+	if err != nil {
+		return false, err
+	}
+
+	dstKey := srcKey
+	if *format != "" {
+		dstKey.Format = *format
+	}
+
+	if *compression != "" {
+		dstKey.Compression = *compression
+	}
+
+	header, hist, err := orderbook.DecodeFile(data)
+	if errors.Is(err, orderbook.ErrLegacyFile) {
+		legacy, err := orderbook.DecodeLegacy(data, srcKey.Format)
+		if err != nil {
+			return false, err
+		}
+
+		scale, err := getScale(srcKey.Symbol)
+		if err != nil {
+			return false, err
+		}
+
+		hist = legacy.Upgrade(scale)
+		header = orderbook.FileHeader{Version: 0, Codec: srcKey.Format, MinerVersion: "legacy"}
+	} else if err != nil {
+		return false, err
+	} else if header.Version == orderbook.FILE_VERSION && header.Codec == dstKey.Format && header.Compression == dstKey.Compression && *prefix == "" {
+		return false, nil
+	}
+
+	hist.BuildKeyframes(*keyframes)
+
+	newHeader := orderbook.NewFileHeader(hist, dstKey.Format, header.MinerVersion)
+	newHeader.Compression, newHeader.CompressionLevel = dstKey.Compression, *level
+	dst := *prefix + dstKey.String()
+
+	log.Printf("Migrating %s (version %d, %s) to %s \n", key, header.Version, header.Codec, dst)
+	if *dryRun {
+		return true, nil
+	}
+
+	if err := store.Put(dst, orderbook.EncodeFile(hist, newHeader)); err != nil {
+		return false, err
+	}
+
+	// an in place migration to a new format must not leave the old file behind,
+	// otherwise the same time range would be indexed twice
+	if dst != key && *prefix == "" {
+		return true, store.Delete(key)
+	}
+
+	return true, nil
+}
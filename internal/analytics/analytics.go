@@ -0,0 +1,177 @@
+package analytics
+
+import (
+	"math"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// Metrics of a single order book. Books have to be sorted as returned by the
+// cache and ToSmallArray, bids ascending so the best bid is the last level and
+// asks ascending so the best ask is the first. Prices and quantities are
+// returned as floats in the units of the symbol, NaN where a metric is
+// undefined, e.g. the mid of a book with an empty side.
+
+type Side int
+
+const (
+	BIDS Side = iota
+	ASKS
+)
+
+// Metric computes a single value from a book.
+type Metric func(ob orderbook.OrderBookSmall) float64
+
+// level returns the i-th best level of a side.
+func level(ob orderbook.OrderBookSmall, side Side, i int) (orderbook.PriceLevel, bool) {
+	if side == BIDS {
+		if i >= len(ob.Bids) {
+			return orderbook.PriceLevel{}, false
+		}
+		return ob.Bids[len(ob.Bids)-1-i], true
+	}
+
+	if i >= len(ob.Asks) {
+		return orderbook.PriceLevel{}, false
+	}
+	return ob.Asks[i], true
+}
+
+func best(ob orderbook.OrderBookSmall) (bid, ask orderbook.PriceLevel, ok bool) {
+	bid, okBid := level(ob, BIDS, 0)
+	ask, okAsk := level(ob, ASKS, 0)
+
+	return bid, ask, okBid && okAsk
+}
+
+func Mid(ob orderbook.OrderBookSmall) float64 {
+	bid, ask, ok := best(ob)
+	if !ok {
+		return math.NaN()
+	}
+
+	return (ob.Scale.Price(bid[0]) + ob.Scale.Price(ask[0])) / 2
+}
+
+// Spread is the best ask minus the best bid.
+func Spread(ob orderbook.OrderBookSmall) float64 {
+	bid, ask, ok := best(ob)
+	if !ok {
+		return math.NaN()
+	}
+
+	return ob.Scale.Price(ask[0]) - ob.Scale.Price(bid[0])
+}
+
+// SpreadBps is the spread in basis points of the mid.
+func SpreadBps(ob orderbook.OrderBookSmall) float64 {
+	return Spread(ob) / Mid(ob) * 1e4
+}
+
+// Microprice weighs the best bid and ask by the quantity on the opposite side,
+// moving the price towards the side more likely to be taken out next.
+func Microprice(ob orderbook.OrderBookSmall) float64 {
+	bid, ask, ok := best(ob)
+	if !ok {
+		return math.NaN()
+	}
+
+	bidPrice, askPrice := ob.Scale.Price(bid[0]), ob.Scale.Price(ask[0])
+	bidQty, askQty := ob.Scale.Qty(bid[1]), ob.Scale.Qty(ask[1])
+
+	return (bidPrice*askQty + askPrice*bidQty) / (bidQty + askQty)
+}
+
+// Imbalance returns (bid qty - ask qty) / (bid qty + ask qty) over the best n
+// levels of each side, between -1 (only asks) and 1 (only bids).
+func Imbalance(ob orderbook.OrderBookSmall, n int) float64 {
+	var bidQty, askQty float64
+	for i := 0; i < n; i++ {
+		if lvl, ok := level(ob, BIDS, i); ok {
+			bidQty += ob.Scale.Qty(lvl[1])
+		}
+
+		if lvl, ok := level(ob, ASKS, i); ok {
+			askQty += ob.Scale.Qty(lvl[1])
+		}
+	}
+
+	if bidQty+askQty == 0 {
+		return math.NaN()
+	}
+
+	return (bidQty - askQty) / (bidQty + askQty)
+}
+
+// DepthWithin returns the quantity resting on a side within bps basis points
+// of the mid.
+func DepthWithin(ob orderbook.OrderBookSmall, side Side, bps float64) float64 {
+	mid := Mid(ob)
+	if math.IsNaN(mid) {
+		return math.NaN()
+	}
+
+	limit := mid * bps / 1e4
+
+	var qty float64
+	for i := 0; ; i++ {
+		lvl, ok := level(ob, side, i)
+		if !ok || math.Abs(ob.Scale.Price(lvl[0])-mid) > limit {
+			return qty
+		}
+
+		qty += ob.Scale.Qty(lvl[1])
+	}
+}
+
+// DepthPoint is a point of a cumulative depth curve, Qty rests at Price or
+// better.
+type DepthPoint struct {
+	Price float64
+	Qty   float64
+}
+
+// DepthCurve returns the cumulative depth of the best n levels of a side,
+// starting at the best price.
+func DepthCurve(ob orderbook.OrderBookSmall, side Side, n int) []DepthPoint {
+	curve := make([]DepthPoint, 0, n)
+
+	var qty float64
+	for i := 0; i < n; i++ {
+		lvl, ok := level(ob, side, i)
+		if !ok {
+			break
+		}
+
+		qty += ob.Scale.Qty(lvl[1])
+		curve = append(curve, DepthPoint{Price: ob.Scale.Price(lvl[0]), Qty: qty})
+	}
+
+	return curve
+}
+
+// VWAP returns the average price paid to fill an order of the given notional
+// (in the quote currency) against a side: a buy walks up the asks, a sell
+// down the bids. It is NaN if the side does not hold enough liquidity.
+func VWAP(ob orderbook.OrderBookSmall, side Side, notional float64) float64 {
+	if notional <= 0 {
+		return math.NaN()
+	}
+
+	remaining, qty := notional, 0.0
+	for i := 0; ; i++ {
+		lvl, ok := level(ob, side, i)
+		if !ok {
+			return math.NaN()
+		}
+
+		price, levelQty := ob.Scale.Price(lvl[0]), ob.Scale.Qty(lvl[1])
+		if price*levelQty >= remaining {
+			qty += remaining / price
+			return notional / qty
+		}
+
+		remaining -= price * levelQty
+		qty += levelQty
+	}
+}
@@ -0,0 +1,133 @@
+package analytics
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+var SCALE = orderbook.Scale{PriceDecimals: 2, QtyDecimals: 3}
+
+// book builds a sorted book from prices and quantities as [price, qty] pairs,
+// bids and asks ascending.
+func book(bids, asks [][2]float64) orderbook.OrderBookSmall {
+	levels := func(side [][2]float64) orderbook.PriceLevelArray {
+		res := make(orderbook.PriceLevelArray, len(side))
+		for i, lvl := range side {
+			res[i] = orderbook.PriceLevel{int64(math.Round(lvl[0] * 100)), int64(math.Round(lvl[1] * 1000))}
+		}
+
+		return res
+	}
+
+	return orderbook.OrderBookSmall{Time: 1, Scale: SCALE, Bids: levels(bids), Asks: levels(asks)}
+}
+
+// BOOK is
+//
+//	bids 99.00 x 3, 99.50 x 2, 100.00 x 1
+//	asks 100.50 x 2, 101.00 x 1, 102.00 x 4
+//
+// with a mid of 100.25.
+var BOOK = book(
+	[][2]float64{{99, 3}, {99.5, 2}, {100, 1}},
+	[][2]float64{{100.5, 2}, {101, 1}, {102, 4}},
+)
+
+var BIDS_ONLY = book([][2]float64{{99, 3}, {99.5, 2}, {100, 1}}, nil)
+
+var EMPTY = book(nil, nil)
+
+func equal(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name   string
+		book   orderbook.OrderBookSmall
+		metric string
+		want   float64
+	}{
+		{"mid", BOOK, "mid", 100.25},
+		{"spread", BOOK, "spread", 0.5},
+		{"spread bps", BOOK, "spreadbps", 0.5 / 100.25 * 1e4},
+		{"microprice", BOOK, "microprice", (100*2 + 100.5*1) / 3.0},
+		{"imbalance of the best level", BOOK, "imbalance1", (1 - 2) / 3.0},
+		{"imbalance of 2 levels", BOOK, "imbalance2", 0},
+		{"imbalance of every level", BOOK, "imbalance3", (6 - 7) / 13.0},
+		{"imbalance of more levels than the book", BOOK, "imbalance10", (6 - 7) / 13.0},
+		{"depth within 50bps", BOOK, "depth50bps", 1 + 2},
+		{"bid depth within 50bps", BOOK, "biddepth50bps", 1},
+		{"ask depth within 50bps", BOOK, "askdepth50bps", 2},
+		{"depth within 100bps", BOOK, "depth100bps", 3 + 3},
+		{"depth within 0bps", BOOK, "depth0bps", 0},
+		{"vwap buy within the best level", BOOK, "vwapbuy100", 100.5},
+		{"vwap buy over 2 levels", BOOK, "vwapbuy300", 300 / (2 + 99/101.0)},
+		{"vwap sell over 2 levels", BOOK, "vwapsell250", 250 / (1 + 150/99.5)},
+		{"vwap buy of the whole side", BOOK, "vwapbuy710", 710 / 7.0},
+		{"vwap buy larger than the book", BOOK, "vwapbuy1000", math.NaN()},
+		{"vwap sell larger than the book", BOOK, "vwapsell1000", math.NaN()},
+
+		{"mid of a one sided book", BIDS_ONLY, "mid", math.NaN()},
+		{"spread of a one sided book", BIDS_ONLY, "spread", math.NaN()},
+		{"microprice of a one sided book", BIDS_ONLY, "microprice", math.NaN()},
+		{"imbalance of a one sided book", BIDS_ONLY, "imbalance3", 1},
+		{"depth of a one sided book", BIDS_ONLY, "depth50bps", math.NaN()},
+		{"vwap sell of a one sided book", BIDS_ONLY, "vwapsell100", 100},
+		{"vwap buy of a one sided book", BIDS_ONLY, "vwapbuy100", math.NaN()},
+
+		{"imbalance of an empty book", EMPTY, "imbalance5", math.NaN()},
+	}
+
+	for _, test := range tests {
+		metric, err := ParseMetric(test.metric)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if got := metric(test.book); !equal(got, test.want) {
+			t.Errorf("%s: %s = %v, want %v", test.name, test.metric, got, test.want)
+		}
+	}
+}
+
+func TestVWAPOfNoNotional(t *testing.T) {
+	if got := VWAP(BOOK, ASKS, 0); !math.IsNaN(got) {
+		t.Errorf("VWAP of 0 = %v, want NaN", got)
+	}
+}
+
+func TestDepthCurve(t *testing.T) {
+	tests := []struct {
+		name string
+		book orderbook.OrderBookSmall
+		side Side
+		n    int
+		want []DepthPoint
+	}{
+		{"asks", BOOK, ASKS, 2, []DepthPoint{{100.5, 2}, {101, 3}}},
+		{"bids deeper than the book", BOOK, BIDS, 5, []DepthPoint{{100, 1}, {99.5, 3}, {99, 6}}},
+		{"empty side", BIDS_ONLY, ASKS, 5, []DepthPoint{}},
+	}
+
+	for _, test := range tests {
+		if got := DepthCurve(test.book, test.side, test.n); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseMetricErrors(t *testing.T) {
+	for _, name := range []string{"", "median", "imbalance", "imbalance0", "depthbps", "depth-5bps", "vwapbuy", "vwapsell0"} {
+		if _, err := ParseMetric(name); err == nil {
+			t.Errorf("%q parsed", name)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package analytics
+
+import (
+	"math"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+func BestBidQty(ob orderbook.OrderBookSmall) float64 {
+	if lvl, ok := level(ob, BIDS, 0); ok {
+		return ob.Scale.Qty(lvl[1])
+	}
+
+	return math.NaN()
+}
+
+func BestAskQty(ob orderbook.OrderBookSmall) float64 {
+	if lvl, ok := level(ob, ASKS, 0); ok {
+		return ob.Scale.Qty(lvl[1])
+	}
+
+	return math.NaN()
+}
+
+// SameTopOfBook reports whether the best bid and ask of two books have the same
+// price and quantity. A missing side only equals a missing side.
+func SameTopOfBook(a, b orderbook.OrderBookSmall) bool {
+	for _, side := range []Side{BIDS, ASKS} {
+		lvlA, okA := level(a, side, 0)
+		lvlB, okB := level(b, side, 0)
+
+		if okA != okB || lvlA != lvlB {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,160 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// Candle is an OHLC bar of a price series over [Time, Time + interval), with
+// statistics of the spread over the same frames. Frames where the price or
+// the spread is undefined are left out, bars without any frame are skipped.
+type Candle struct {
+	Time   int64
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Frames int
+
+	SpreadMean float64
+	SpreadMin  float64
+	SpreadMax  float64
+}
+
+const (
+	MIN_CANDLE_INTERVAL = int64(time.Second / time.Millisecond)
+	MAX_CANDLE_INTERVAL = int64(24 * time.Hour / time.Millisecond)
+)
+
+// ParseInterval reads a candle interval such as 1s, 5m, 1h or 1d into
+// milliseconds.
+func ParseInterval(s string) (int64, error) {
+	var interval int64
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseInt(days, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %s", s)
+		}
+		interval = n * MAX_CANDLE_INTERVAL
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %s", s)
+		}
+		interval = d.Milliseconds()
+	}
+
+	if interval < MIN_CANDLE_INTERVAL || interval > MAX_CANDLE_INTERVAL {
+		return 0, fmt.Errorf("interval must be between 1s and 1d")
+	}
+
+	return interval, nil
+}
+
+func BestBid(ob orderbook.OrderBookSmall) float64 {
+	if lvl, ok := level(ob, BIDS, 0); ok {
+		return ob.Scale.Price(lvl[0])
+	}
+
+	return math.NaN()
+}
+
+func BestAsk(ob orderbook.OrderBookSmall) float64 {
+	if lvl, ok := level(ob, ASKS, 0); ok {
+		return ob.Scale.Price(lvl[0])
+	}
+
+	return math.NaN()
+}
+
+// ParseCandleSource looks up the price series candles are built from: mid,
+// microprice, bid or ask. All of them only need the best level of each side.
+func ParseCandleSource(name string) (Metric, error) {
+	switch name {
+	case "mid":
+		return Mid, nil
+	case "microprice":
+		return Microprice, nil
+	case "bid":
+		return BestBid, nil
+	case "ask":
+		return BestAsk, nil
+	default:
+		return nil, fmt.Errorf("unknown candle source %s, expected mid, microprice, bid or ask", name)
+	}
+}
+
+// CandleBuilder builds candles from a stream of frames added in time order.
+// Bars are aligned to multiples of Interval since the unix epoch.
+type CandleBuilder struct {
+	Interval int64
+	Source   Metric
+
+	current   Candle
+	spreadSum float64
+}
+
+func NewCandleBuilder(interval int64, source Metric) *CandleBuilder {
+	return &CandleBuilder{Interval: interval, Source: source}
+}
+
+// Add returns the candles completed by obs.
+func (b *CandleBuilder) Add(obs []orderbook.OrderBookSmall) []Candle {
+	res := make([]Candle, 0)
+
+	for _, ob := range obs {
+		price, spread := b.Source(ob), Spread(ob)
+		if math.IsNaN(price) || math.IsNaN(spread) {
+			continue
+		}
+
+		bar := ob.Time - ob.Time%b.Interval
+		if b.current.Frames > 0 && bar != b.current.Time {
+			res = append(res, b.finish())
+		}
+
+		if b.current.Frames == 0 {
+			b.current = Candle{Time: bar, Open: price, High: price, Low: price, SpreadMin: spread, SpreadMax: spread}
+			b.spreadSum = 0
+		}
+
+		b.current.High = math.Max(b.current.High, price)
+		b.current.Low = math.Min(b.current.Low, price)
+		b.current.Close = price
+		b.current.SpreadMin = math.Min(b.current.SpreadMin, spread)
+		b.current.SpreadMax = math.Max(b.current.SpreadMax, spread)
+		b.current.Frames++
+		b.spreadSum += spread
+	}
+
+	return res
+}
+
+func (b *CandleBuilder) finish() Candle {
+	candle := b.current
+	candle.SpreadMean = b.spreadSum / float64(candle.Frames)
+
+	b.current = Candle{}
+
+	return candle
+}
+
+// Flush returns the last, possibly incomplete, candle.
+func (b *CandleBuilder) Flush() []Candle {
+	if b.current.Frames == 0 {
+		return nil
+	}
+
+	return []Candle{b.finish()}
+}
+
+// Candles builds the candles of a window.
+func Candles(obs []orderbook.OrderBookSmall, interval int64, source Metric) []Candle {
+	b := NewCandleBuilder(interval, source)
+	return append(b.Add(obs), b.Flush()...)
+}
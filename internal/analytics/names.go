@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// ParseMetric looks up a metric by name. Parameterised metrics carry their
+// parameter in the name:
+//
+//	mid, spread, spreadbps, microprice
+//	imbalance10      Imbalance of the best 10 levels
+//	depth50bps       DepthWithin 50 bps of the mid, both sides summed
+//	biddepth50bps    DepthWithin 50 bps on the bid side, askdepth50bps likewise
+//	vwapbuy100000    VWAP of buying 100000 in the quote currency, vwapsell likewise
+func ParseMetric(name string) (Metric, error) {
+	switch name {
+	case "mid":
+		return Mid, nil
+	case "spread":
+		return Spread, nil
+	case "spreadbps":
+		return SpreadBps, nil
+	case "microprice":
+		return Microprice, nil
+	}
+
+	if n, ok := strings.CutPrefix(name, "imbalance"); ok {
+		levels, err := strconv.Atoi(n)
+		if err != nil || levels <= 0 {
+			return nil, fmt.Errorf("metric %s needs a positive number of levels, e.g. imbalance10", name)
+		}
+
+		return ImbalanceOf(levels), nil
+	}
+
+	if bps, ok := strings.CutSuffix(name, "bps"); ok {
+		var side string
+		for _, prefix := range []string{"biddepth", "askdepth", "depth"} {
+			if rest, ok := strings.CutPrefix(bps, prefix); ok {
+				side, bps = prefix, rest
+				break
+			}
+		}
+
+		limit, err := strconv.ParseFloat(bps, 64)
+		if side == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("metric %s needs a distance from the mid in bps, e.g. depth50bps", name)
+		}
+
+		switch side {
+		case "biddepth":
+			return func(ob orderbook.OrderBookSmall) float64 { return DepthWithin(ob, BIDS, limit) }, nil
+		case "askdepth":
+			return func(ob orderbook.OrderBookSmall) float64 { return DepthWithin(ob, ASKS, limit) }, nil
+		default:
+			return DepthWithinOf(limit), nil
+		}
+	}
+
+	for prefix, side := range map[string]Side{"vwapbuy": ASKS, "vwapsell": BIDS} {
+		if n, ok := strings.CutPrefix(name, prefix); ok {
+			notional, err := strconv.ParseFloat(n, 64)
+			if err != nil || notional <= 0 {
+				return nil, fmt.Errorf("metric %s needs a positive notional, e.g. %s100000", name, prefix)
+			}
+
+			return VWAPOf(side, notional), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown metric %s", name)
+}
@@ -0,0 +1,45 @@
+package analytics
+
+import "github.com/crypto_pickle/internal/orderbook"
+
+// Series evaluates a metric on every book of a window.
+func Series(obs []orderbook.OrderBookSmall, metric Metric) []float64 {
+	res := make([]float64, len(obs))
+	for i, ob := range obs {
+		res[i] = metric(ob)
+	}
+
+	return res
+}
+
+// The helpers below bind the parameters of a metric so it can be passed to
+// Series, e.g. Series(obs, ImbalanceOf(10)).
+
+func ImbalanceOf(n int) Metric {
+	return func(ob orderbook.OrderBookSmall) float64 {
+		return Imbalance(ob, n)
+	}
+}
+
+// DepthWithinOf sums the depth of both sides within bps of the mid.
+func DepthWithinOf(bps float64) Metric {
+	return func(ob orderbook.OrderBookSmall) float64 {
+		return DepthWithin(ob, BIDS, bps) + DepthWithin(ob, ASKS, bps)
+	}
+}
+
+func VWAPOf(side Side, notional float64) Metric {
+	return func(ob orderbook.OrderBookSmall) float64 {
+		return VWAP(ob, side, notional)
+	}
+}
+
+// DepthCurves returns the depth curve of a side for every book of a window.
+func DepthCurves(obs []orderbook.OrderBookSmall, side Side, n int) [][]DepthPoint {
+	res := make([][]DepthPoint, len(obs))
+	for i, ob := range obs {
+		res[i] = DepthCurve(ob, side, n)
+	}
+
+	return res
+}
@@ -0,0 +1,85 @@
+package binanceinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/crypto_pickle/internal/utils"
+)
+
+// The exchange info of binance as needed by the miner and the tools, i.e. the
+// scales of symbols.
+
+const SPOT_API = "https://api.binance.com/api/v3/"
+
+type RawFilter struct {
+	FilterType string `json:"filterType"`
+	TickSize   string `json:"tickSize"`
+	StepSize   string `json:"stepSize"`
+}
+
+type RawSymbolInfo struct {
+	Symbol  string      `json:"symbol"`
+	Filters []RawFilter `json:"filters"`
+}
+
+type RawExchangeInfo struct {
+	Symbols []RawSymbolInfo `json:"symbols"`
+}
+
+// ToScale derives the tick and lot scale of a symbol from its PRICE_FILTER
+// tickSize and LOT_SIZE stepSize.
+func (info RawSymbolInfo) ToScale() orderbook.Scale {
+	var scale orderbook.Scale
+	for _, filter := range info.Filters {
+		switch filter.FilterType {
+		case "PRICE_FILTER":
+			scale.PriceDecimals = utils.DecimalPlaces(filter.TickSize)
+		case "LOT_SIZE":
+			scale.QtyDecimals = utils.DecimalPlaces(filter.StepSize)
+		}
+	}
+
+	return scale
+}
+
+// ParseScale finds the scale of symbol in an exchange info response.
+func ParseScale(data []byte, symbol string) (orderbook.Scale, error) {
+	info := new(RawExchangeInfo)
+	if err := json.Unmarshal(data, info); err != nil {
+		return orderbook.Scale{}, err
+	}
+
+	for _, info := range info.Symbols {
+		if info.Symbol == symbol {
+			return info.ToScale(), nil
+		}
+	}
+
+	return orderbook.Scale{}, fmt.Errorf("exchange info has no symbol %s", symbol)
+}
+
+// GetSpotScale looks up the scale of a spot symbol, e.g. BTCUSDT.
+func GetSpotScale(symbol string) (orderbook.Scale, error) {
+	url := fmt.Sprintf("%sexchangeInfo?symbol=%s", SPOT_API, symbol)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return orderbook.Scale{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return orderbook.Scale{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return orderbook.Scale{}, fmt.Errorf("%s returned %s: %s", url, resp.Status, body)
+	}
+
+	return ParseScale(body, symbol)
+}
@@ -0,0 +1,47 @@
+package export
+
+import (
+	"io"
+
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// ARROW_STREAM_MIME is the media type of the Arrow IPC stream format.
+const ARROW_STREAM_MIME = "application/vnd.apache.arrow.stream"
+
+// ArrowWriter writes frames as an Arrow IPC stream of BookSchema, one record
+// batch per call to Write.
+type ArrowWriter struct {
+	builder *BookRecordBuilder
+	writer  *ipc.Writer
+}
+
+func NewArrowWriter(w io.Writer, layout string, depth int) (*ArrowWriter, error) {
+	builder, err := NewBookRecordBuilder(layout, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArrowWriter{
+		builder: builder,
+		writer:  ipc.NewWriter(w, ipc.WithSchema(builder.Schema())),
+	}, nil
+}
+
+func (aw *ArrowWriter) Write(symbol string, obs []orderbook.OrderBookSmall) error {
+	for _, ob := range obs {
+		aw.builder.Append(symbol, ob)
+	}
+
+	rec := aw.builder.NewRecord()
+	defer rec.Release()
+
+	return aw.writer.Write(rec)
+}
+
+// Close ends the stream. It does not close the underlying writer.
+func (aw *ArrowWriter) Close() error {
+	aw.builder.Release()
+	return aw.writer.Close()
+}
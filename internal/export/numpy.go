@@ -0,0 +1,143 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// NumpyWriter collects frames into a float64 tensor of shape
+// (frames, depth, 2, 2), indexed by frame, level (0 is the best), side (0 bids,
+// 1 asks) and price/qty. Missing levels are NaN. The tensor is only written on
+// Close, since the npy header has to hold its shape.
+//
+// As .npy the file holds just the tensor. As .npz it is stored as "books"
+// next to "times" (unix milliseconds) and, with normalize set, "mids".
+//
+// With normalize set prices are given relative to the mid price of their
+// frame, (price - mid) / mid.
+type NumpyWriter struct {
+	w         io.Writer
+	npz       bool
+	depth     int
+	normalize bool
+
+	times []int64
+	mids  []float64
+	books []float64
+}
+
+func NewNumpyWriter(w io.Writer, depth int, npz bool, normalize bool) *NumpyWriter {
+	return &NumpyWriter{w: w, npz: npz, depth: depth, normalize: normalize}
+}
+
+func mid(ob orderbook.OrderBookSmall) float64 {
+	if len(ob.Bids) == 0 || len(ob.Asks) == 0 {
+		return math.NaN()
+	}
+
+	return (ob.Scale.Price(ob.Bids[len(ob.Bids)-1][0]) + ob.Scale.Price(ob.Asks[0][0])) / 2
+}
+
+func (nw *NumpyWriter) Write(symbol string, obs []orderbook.OrderBookSmall) error {
+	for _, ob := range obs {
+		m := mid(ob)
+
+		nw.times = append(nw.times, ob.Time)
+		nw.mids = append(nw.mids, m)
+
+		for i := 0; i < nw.depth; i++ {
+			for side, levels := range [2]orderbook.PriceLevelArray{ob.Bids, ob.Asks} {
+				lvl, ok := level(levels, i, side == 0)
+				if !ok {
+					nw.books = append(nw.books, math.NaN(), math.NaN())
+					continue
+				}
+
+				price := ob.Scale.Price(lvl[0])
+				if nw.normalize {
+					price = (price - m) / m
+				}
+
+				nw.books = append(nw.books, price, ob.Scale.Qty(lvl[1]))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (nw *NumpyWriter) Close() error {
+	shape := []int{len(nw.times), nw.depth, 2, 2}
+	if !nw.npz {
+		return writeNpy(nw.w, "<f8", shape, nw.books)
+	}
+
+	archive := zip.NewWriter(nw.w)
+
+	arrays := []npyArray{
+		{"books", "<f8", shape, nw.books},
+		{"times", "<i8", shape[:1], nw.times},
+	}
+	if nw.normalize {
+		arrays = append(arrays, npyArray{"mids", "<f8", shape[:1], nw.mids})
+	}
+
+	for _, array := range arrays {
+		f, err := archive.Create(array.name + ".npy")
+		if err != nil {
+			return err
+		}
+
+		if err := writeNpy(f, array.descr, array.shape, array.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+type npyArray struct {
+	name  string
+	descr string
+	shape []int
+	data  interface{}
+}
+
+// writeNpy writes a C ordered array in version 1.0 of the npy format, see
+// https://numpy.org/doc/stable/reference/generated/numpy.lib.format.html
+func writeNpy(w io.Writer, descr string, shape []int, data interface{}) error {
+	dims := make([]string, len(shape))
+	for i, n := range shape {
+		dims[i] = fmt.Sprint(n)
+	}
+
+	shapeStr := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		shapeStr += ","
+	}
+
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", descr, shapeStr)
+
+	// magic, version and header length take 10 bytes, the header is padded
+	// with spaces so the data starts at a multiple of 64 bytes
+	pad := 64 - (10+len(header)+1)%64
+	header += strings.Repeat(" ", pad%64) + "\n"
+
+	buf := bytes.NewBuffer(make([]byte, 0, 10+len(header)))
+	buf.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, data)
+}
@@ -0,0 +1,65 @@
+package export
+
+import (
+	"io"
+
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/compress"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// ParquetWriter writes reconstructed frames to a zstd compressed Parquet file
+// of BookSchema, one row group per call to Write.
+type ParquetWriter struct {
+	builder *BookRecordBuilder
+	writer  *pqarrow.FileWriter
+}
+
+func NewParquetWriter(w io.Writer, layout string, depth int) (*ParquetWriter, error) {
+	builder, err := NewBookRecordBuilder(layout, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Zstd))
+	writer, err := pqarrow.NewFileWriter(builder.Schema(), w, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		builder.Release()
+		return nil, err
+	}
+
+	return &ParquetWriter{builder: builder, writer: writer}, nil
+}
+
+func (pw *ParquetWriter) Write(symbol string, obs []orderbook.OrderBookSmall) error {
+	for _, ob := range obs {
+		pw.builder.Append(symbol, ob)
+	}
+
+	rec := pw.builder.NewRecord()
+	defer rec.Release()
+
+	return pw.writer.Write(rec)
+}
+
+// Close writes the footer of the file and closes w if it is an io.Closer.
+func (pw *ParquetWriter) Close() error {
+	pw.builder.Release()
+	return pw.writer.Close()
+}
+
+// HistToParquet writes every frame of a history to w as Parquet.
+func HistToParquet(w io.Writer, hist orderbook.OrderBookHistory, layout string, depth int) error {
+	pw, err := NewParquetWriter(w, layout, depth)
+	if err != nil {
+		return err
+	}
+
+	if err := pw.Write(hist.Symbol, hist.ToSmallArray(true)); err != nil {
+		pw.Close()
+		return err
+	}
+
+	return pw.Close()
+}
@@ -0,0 +1,149 @@
+package export
+
+import (
+	"fmt"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// Layouts of exported order books. The wide layout has one row per frame with
+// a price and quantity column for each of the top levels of both sides, the
+// long layout has one row per level.
+const (
+	LAYOUT_WIDE = "wide"
+	LAYOUT_LONG = "long"
+)
+
+// BookSchema returns the arrow schema of frames exported with the given layout
+// and depth. Levels are numbered from 0, the best bid and ask.
+//
+//	wide: time, symbol, bid_price_0, bid_qty_0, ..., ask_price_0, ask_qty_0, ...
+//	long: time, symbol, side ("bid" or "ask"), level, price, qty
+func BookSchema(layout string, depth int) (*arrow.Schema, error) {
+	fields := []arrow.Field{
+		{Name: "time", Type: arrow.FixedWidthTypes.Timestamp_ms},
+		{Name: "symbol", Type: arrow.BinaryTypes.String},
+	}
+
+	switch layout {
+	case LAYOUT_WIDE:
+		for _, side := range []string{"bid", "ask"} {
+			for i := 0; i < depth; i++ {
+				fields = append(fields,
+					arrow.Field{Name: fmt.Sprintf("%s_price_%d", side, i), Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+					arrow.Field{Name: fmt.Sprintf("%s_qty_%d", side, i), Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+				)
+			}
+		}
+	case LAYOUT_LONG:
+		fields = append(fields,
+			arrow.Field{Name: "side", Type: arrow.BinaryTypes.String},
+			arrow.Field{Name: "level", Type: arrow.PrimitiveTypes.Int32},
+			arrow.Field{Name: "price", Type: arrow.PrimitiveTypes.Float64},
+			arrow.Field{Name: "qty", Type: arrow.PrimitiveTypes.Float64},
+		)
+	default:
+		return nil, fmt.Errorf("unknown layout %s", layout)
+	}
+
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// BookRecordBuilder collects frames into arrow records of BookSchema.
+type BookRecordBuilder struct {
+	layout string
+	depth  int
+
+	builder *array.RecordBuilder
+}
+
+func NewBookRecordBuilder(layout string, depth int) (*BookRecordBuilder, error) {
+	schema, err := BookSchema(layout, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BookRecordBuilder{
+		layout:  layout,
+		depth:   depth,
+		builder: array.NewRecordBuilder(memory.DefaultAllocator, schema),
+	}, nil
+}
+
+func (b *BookRecordBuilder) Schema() *arrow.Schema {
+	return b.builder.Schema()
+}
+
+// level returns the i-th best level of a side, bids are sorted ascending so the
+// best bid is the last one.
+func level(levels orderbook.PriceLevelArray, i int, bids bool) (orderbook.PriceLevel, bool) {
+	if i >= len(levels) {
+		return orderbook.PriceLevel{}, false
+	}
+
+	if bids {
+		return levels[len(levels)-1-i], true
+	}
+
+	return levels[i], true
+}
+
+func (b *BookRecordBuilder) Append(symbol string, ob orderbook.OrderBookSmall) {
+	if b.layout == LAYOUT_LONG {
+		b.appendLong(symbol, ob)
+		return
+	}
+
+	b.builder.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(ob.Time))
+	b.builder.Field(1).(*array.StringBuilder).Append(symbol)
+
+	col := 2
+	for side, levels := range [2]orderbook.PriceLevelArray{ob.Bids, ob.Asks} {
+		for i := 0; i < b.depth; i++ {
+			prices := b.builder.Field(col).(*array.Float64Builder)
+			qtys := b.builder.Field(col + 1).(*array.Float64Builder)
+			col += 2
+
+			lvl, ok := level(levels, i, side == 0)
+			if !ok {
+				prices.AppendNull()
+				qtys.AppendNull()
+				continue
+			}
+
+			prices.Append(ob.Scale.Price(lvl[0]))
+			qtys.Append(ob.Scale.Qty(lvl[1]))
+		}
+	}
+}
+
+func (b *BookRecordBuilder) appendLong(symbol string, ob orderbook.OrderBookSmall) {
+	for side, levels := range [2]orderbook.PriceLevelArray{ob.Bids, ob.Asks} {
+		for i := 0; i < b.depth; i++ {
+			lvl, ok := level(levels, i, side == 0)
+			if !ok {
+				break
+			}
+
+			b.builder.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(ob.Time))
+			b.builder.Field(1).(*array.StringBuilder).Append(symbol)
+			b.builder.Field(2).(*array.StringBuilder).Append([2]string{"bid", "ask"}[side])
+			b.builder.Field(3).(*array.Int32Builder).Append(int32(i))
+			b.builder.Field(4).(*array.Float64Builder).Append(ob.Scale.Price(lvl[0]))
+			b.builder.Field(5).(*array.Float64Builder).Append(ob.Scale.Qty(lvl[1]))
+		}
+	}
+}
+
+// NewRecord returns the frames appended so far and resets the builder. The
+// record must be released by the caller.
+func (b *BookRecordBuilder) NewRecord() arrow.Record {
+	return b.builder.NewRecord()
+}
+
+func (b *BookRecordBuilder) Release() {
+	b.builder.Release()
+}
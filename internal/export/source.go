@@ -0,0 +1,132 @@
+package export
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/crypto_pickle/internal/orderbook"
+	"github.com/crypto_pickle/internal/storage"
+)
+
+// FindKeys returns the keys of every history of symbol overlapping [start, end]
+// in time order. An end of 0 means no upper bound.
+func FindKeys(store storage.Store, symbol string, start, end int64) ([]storage.Key, error) {
+	if end == 0 {
+		end = math.MaxInt64
+	}
+
+	names, err := store.List(symbol + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]storage.Key, 0, len(names))
+	for _, name := range names {
+		key, err := storage.ParseKey(name)
+		if err != nil {
+			log.Printf("skipping %s: %s \n", name, err)
+			continue
+		}
+
+		if key.Symbol == symbol && key.End >= start && key.Start <= end {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Start < keys[j].Start
+	})
+
+	return keys, nil
+}
+
+// LoadHistory downloads and decodes a single history.
+func LoadHistory(store storage.Store, key storage.Key) (orderbook.OrderBookHistory, error) {
+	body, err := store.Open(key.String())
+	if err != nil {
+		return orderbook.OrderBookHistory{}, err
+	}
+	defer body.Close()
+
+	header, dec, err := orderbook.OpenFile(body)
+	if err != nil {
+		return orderbook.OrderBookHistory{}, err
+	}
+	defer dec.Close()
+
+	hist, err := dec.ReadAll()
+	hist.SnapshotUpdateId, hist.Gap, hist.GapBefore = header.SnapshotUpdateId, header.Gap, header.GapBefore
+
+	return hist, err
+}
+
+// replay reconstructs the frames of a history from the last keyframe at or
+// before start on, each cut to the best depth levels per side. It returns the
+// frame of the history the first book belongs to.
+func replay(store storage.Store, key storage.Key, start int64, depth int) ([]orderbook.OrderBookSmall, int, error) {
+	open := func(offset int64) (io.ReadCloser, error) {
+		return store.OpenAt(key.String(), offset)
+	}
+
+	_, dec, err := orderbook.OpenFileAt(open, start)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer dec.Close()
+
+	obs := make([]orderbook.OrderBookSmall, 0, 1024)
+	err = dec.Replay(func(ob *orderbook.SortedOrderBook) bool {
+		obs = append(obs, ob.ToOrderBookSmall(depth))
+		return true
+	})
+
+	return obs, dec.Frame, err
+}
+
+// Frames calls f with the frames of every history of symbol in [start, end],
+// one history at a time and in time order. Frames are cut to depth levels per
+// side and sampled at freq frames per second (10 or 1) as by the api, then
+// stitched together with an orderbook.Stitcher. Legacy files are skipped, they
+// have to be migrated first.
+func Frames(store storage.Store, symbol string, start, end int64, depth, freq int, f func(obs []orderbook.OrderBookSmall) error) error {
+	if end == 0 {
+		end = math.MaxInt64
+	}
+
+	keys, err := FindKeys(store, symbol, start, end)
+	if err != nil {
+		return err
+	}
+
+	stitcher := orderbook.NewStitcher(start, end)
+	for _, key := range keys {
+		obs, frame, err := replay(store, key, start, depth)
+		if errors.Is(err, orderbook.ErrLegacyFile) {
+			log.Printf("skipping %s: %s \n", key, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// frames are sampled by their index in the history, a replay starting
+		// at a keyframe is aligned to the samples of a full one
+		iter := 10 / freq
+		if skip := (iter - frame%iter) % iter; skip < len(obs) {
+			obs = obs[skip:]
+		} else {
+			obs = nil
+		}
+
+		window := orderbook.OrderBookSmallArray(obs).Cut(depth, freq)
+		if obs := stitcher.Add(window); len(obs) > 0 {
+			if err := f(obs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
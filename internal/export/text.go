@@ -0,0 +1,102 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// CSVWriter writes frames as CSV in the wide layout of BookSchema, with prices
+// and quantities as exact decimals. Missing levels are left empty.
+type CSVWriter struct {
+	w     *csv.Writer
+	depth int
+	row   []string
+}
+
+func NewCSVWriter(w io.Writer, depth int) (*CSVWriter, error) {
+	schema, err := BookSchema(LAYOUT_WIDE, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]string, len(schema.Fields()))
+	for i, field := range schema.Fields() {
+		header[i] = field.Name
+	}
+
+	cw := &CSVWriter{w: csv.NewWriter(w), depth: depth, row: make([]string, len(header))}
+	return cw, cw.w.Write(header)
+}
+
+func (cw *CSVWriter) Write(symbol string, obs []orderbook.OrderBookSmall) error {
+	for _, ob := range obs {
+		cw.row[0] = strconv.FormatInt(ob.Time, 10)
+		cw.row[1] = symbol
+
+		col := 2
+		for side, levels := range [2]orderbook.PriceLevelArray{ob.Bids, ob.Asks} {
+			for i := 0; i < cw.depth; i++ {
+				if lvl, ok := level(levels, i, side == 0); ok {
+					cw.row[col], cw.row[col+1] = ob.Scale.FormatPrice(lvl[0]), ob.Scale.FormatQty(lvl[1])
+				} else {
+					cw.row[col], cw.row[col+1] = "", ""
+				}
+				col += 2
+			}
+		}
+
+		if err := cw.w.Write(cw.row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cw *CSVWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// NDJSONWriter writes one book per line in the format of the api,
+// {"Symbol":"btcusdt","Time":1,"Bids":[[30000.01,1.5]],"Asks":[...]} with bids
+// in ascending order.
+type NDJSONWriter struct {
+	w *bufio.Writer
+}
+
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{w: bufio.NewWriter(w)}
+}
+
+func (nw *NDJSONWriter) Write(symbol string, obs []orderbook.OrderBookSmall) error {
+	prefix, err := json.Marshal(symbol)
+	if err != nil {
+		return err
+	}
+
+	for _, ob := range obs {
+		book, err := ob.MarshalJSON()
+		if err != nil {
+			return err
+		}
+
+		// splice the symbol in front of the fields of the book
+		fmt.Fprintf(nw.w, `{"Symbol":%s,%s`, prefix, book[1:])
+		if err := nw.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (nw *NDJSONWriter) Close() error {
+	return nw.w.Flush()
+}
@@ -0,0 +1,216 @@
+package heatmap
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/crypto_pickle/internal/analytics"
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// Heatmap renders the liquidity of a book over time: every column of the image
+// is a slice of [Start, End), every row a bucket of [Low, High] with the
+// highest prices at the top, and the colour of a pixel the mean quantity
+// resting in the bucket over the frames of the slice. The mean mid price of
+// each slice is drawn over it as a white line.
+type Heatmap struct {
+	Start, End    int64
+	Low, High     float64
+	Width, Height int
+
+	qty    []float64
+	frames []int
+	mid    []float64
+	mids   []int
+}
+
+var (
+	BACKGROUND = color.RGBA{24, 24, 24, 255}
+	MID_COLOR  = color.RGBA{255, 255, 255, 255}
+
+	// colours of quantities from none to the largest one of the image
+	RAMP = []color.RGBA{
+		{0, 0, 0, 255},
+		{0, 0, 160, 255},
+		{0, 180, 255, 255},
+		{255, 220, 0, 255},
+		{255, 40, 0, 255},
+	}
+)
+
+func New(start, end int64, low, high float64, width, height int) (*Heatmap, error) {
+	if end <= start {
+		return nil, errors.New("heatmap end must be after its start")
+	} else if !finite(low) || !finite(high) || !finite(high-low) {
+		return nil, errors.New("heatmap low and high prices must be finite")
+	} else if high <= low {
+		return nil, errors.New("heatmap high price must be above its low price")
+	} else if width <= 0 || height <= 0 {
+		return nil, errors.New("heatmap width and height must be positive")
+	}
+
+	return &Heatmap{
+		Start:  start,
+		End:    end,
+		Low:    low,
+		High:   high,
+		Width:  width,
+		Height: height,
+		qty:    make([]float64, width*height),
+		frames: make([]int, width),
+		mid:    make([]float64, width),
+		mids:   make([]int, width),
+	}, nil
+}
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+func (h *Heatmap) column(time int64) (int, bool) {
+	if time < h.Start || time > h.End {
+		return 0, false
+	}
+
+	x := int((time - h.Start) * int64(h.Width) / (h.End - h.Start))
+	if x == h.Width {
+		x--
+	}
+
+	return x, true
+}
+
+func (h *Heatmap) row(price float64) (int, bool) {
+	if price < h.Low || price > h.High {
+		return 0, false
+	}
+
+	y := int((h.High - price) / (h.High - h.Low) * float64(h.Height))
+	if y == h.Height {
+		y--
+	}
+
+	return y, true
+}
+
+// Add accumulates frames, frames outside of [Start, End] are ignored.
+func (h *Heatmap) Add(obs []orderbook.OrderBookSmall) {
+	for _, ob := range obs {
+		x, ok := h.column(ob.Time)
+		if !ok {
+			continue
+		}
+
+		h.frames[x]++
+		for _, levels := range []orderbook.PriceLevelArray{ob.Bids, ob.Asks} {
+			for _, level := range levels {
+				if y, ok := h.row(ob.Scale.Price(level[0])); ok {
+					h.qty[y*h.Width+x] += ob.Scale.Qty(level[1])
+				}
+			}
+		}
+
+		if mid := analytics.Mid(ob); !math.IsNaN(mid) {
+			h.mid[x] += mid
+			h.mids[x]++
+		}
+	}
+}
+
+// ramp interpolates RAMP at v in [0, 1].
+func ramp(v float64) color.RGBA {
+	pos := v * float64(len(RAMP)-1)
+	i := int(pos)
+	if i >= len(RAMP)-1 {
+		return RAMP[len(RAMP)-1]
+	}
+
+	f := pos - float64(i)
+	a, b := RAMP[i], RAMP[i+1]
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*f)
+	}
+
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// Image renders the frames added so far. Quantities are coloured on a log
+// scale so thin levels stay visible next to large walls, columns without any
+// frame are left as BACKGROUND.
+func (h *Heatmap) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, h.Width, h.Height))
+
+	max := 0.0
+	for i, qty := range h.qty {
+		if frames := h.frames[i%h.Width]; frames > 0 {
+			max = math.Max(max, qty/float64(frames))
+		}
+	}
+
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			if h.frames[x] == 0 {
+				img.SetRGBA(x, y, BACKGROUND)
+				continue
+			}
+
+			v := 0.0
+			if max > 0 {
+				v = math.Log1p(h.qty[y*h.Width+x]/float64(h.frames[x])) / math.Log1p(max)
+			}
+
+			img.SetRGBA(x, y, ramp(v))
+		}
+	}
+
+	// the mid line joins the rows of neighbouring columns so jumps stay visible
+	last := -1
+	for x := 0; x < h.Width; x++ {
+		if h.mids[x] == 0 {
+			last = -1
+			continue
+		}
+
+		y, ok := h.row(h.mid[x] / float64(h.mids[x]))
+		if !ok {
+			last = -1
+			continue
+		}
+
+		from, to := y, y
+		if last >= 0 {
+			from, to = minInt(last, y), maxInt(last, y)
+		}
+
+		for i := from; i <= to; i++ {
+			img.SetRGBA(x, i, MID_COLOR)
+		}
+
+		last = y
+	}
+
+	return img
+}
+
+// Encode writes the rendered heatmap as a PNG.
+func (h *Heatmap) Encode(w io.Writer) error {
+	return png.Encode(w, h.Image())
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,133 @@
+package orderbook
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Aggregation groups levels into price buckets, summing their quantities.
+// Buckets are either Size in price units wide (e.g. 10 for $10 buckets) or,
+// when Relative is set, Size percent of the mid price wide. Bids are rounded
+// down and asks up to their bucket, so the two sides never share a bucket.
+type Aggregation struct {
+	Size     float64
+	Relative bool
+}
+
+// ParseAggregation reads an aggregation written as "10" for absolute or
+// "0.1%" for relative buckets.
+func ParseAggregation(s string) (Aggregation, error) {
+	agg := Aggregation{}
+
+	s, agg.Relative = strings.CutSuffix(s, "%")
+
+	size, err := strconv.ParseFloat(s, 64)
+	if err != nil || size <= 0 || math.IsInf(size, 0) || math.IsNaN(size) {
+		return agg, fmt.Errorf("aggregation must be a positive price or percentage, e.g. 10 or 0.1%%")
+	}
+	agg.Size = size
+
+	return agg, nil
+}
+
+// bucketTicks returns the width of a bucket in ticks, at least one tick.
+func (agg Aggregation) bucketTicks(scale Scale, midTicks float64) int64 {
+	var ticks float64
+	if agg.Relative {
+		ticks = midTicks * agg.Size / 100
+	} else {
+		ticks = agg.Size * math.Pow10(int(scale.PriceDecimals))
+	}
+
+	if ticks < 1 || math.IsNaN(ticks) {
+		return 1
+	}
+
+	return int64(math.Round(ticks))
+}
+
+func floorBucket(price, bucket int64) int64 {
+	return price - price%bucket
+}
+
+func ceilBucket(price, bucket int64) int64 {
+	if rem := price % bucket; rem != 0 {
+		return price + bucket - rem
+	}
+
+	return price
+}
+
+// aggregateLevels buckets sorted levels, keeping them sorted.
+func aggregateLevels(levels PriceLevelArray, bucket int64, round func(price, bucket int64) int64) PriceLevelArray {
+	res := make(PriceLevelArray, 0, len(levels))
+
+	for _, level := range levels {
+		price := round(level[0], bucket)
+		if n := len(res); n > 0 && res[n-1][0] == price {
+			res[n-1][1] += level[1]
+		} else {
+			res = append(res, PriceLevel{price, level[1]})
+		}
+	}
+
+	return res
+}
+
+// Aggregate returns the book with its levels grouped into buckets. The book's
+// levels must be sorted, see SortAndCut.
+func (ob OrderBookSmall) Aggregate(agg Aggregation) OrderBookSmall {
+	midTicks := math.NaN()
+	if len(ob.Bids) > 0 && len(ob.Asks) > 0 {
+		midTicks = float64(ob.Bids[len(ob.Bids)-1][0]+ob.Asks[0][0]) / 2
+	}
+
+	bucket := agg.bucketTicks(ob.Scale, midTicks)
+
+	ob.Bids = aggregateLevels(ob.Bids, bucket, floorBucket)
+	ob.Asks = aggregateLevels(ob.Asks, bucket, ceilBucket)
+
+	return ob
+}
+
+func aggregateDepthLevel(dl DepthLevel, bucket int64, round func(price, bucket int64) int64) DepthLevel {
+	res := make(DepthLevel)
+	for price, volume := range dl {
+		res[round(price, bucket)] += volume
+	}
+
+	return res
+}
+
+// Aggregate returns a copy of the book with its levels grouped into buckets.
+func (ob OrderBook) Aggregate(agg Aggregation) OrderBook {
+	midTicks := math.NaN()
+	if len(ob.Bids) > 0 && len(ob.Asks) > 0 {
+		bestBid, bestAsk := int64(math.MinInt64), int64(math.MaxInt64)
+		for price := range ob.Bids {
+			if price > bestBid {
+				bestBid = price
+			}
+		}
+		for price := range ob.Asks {
+			if price < bestAsk {
+				bestAsk = price
+			}
+		}
+
+		midTicks = float64(bestBid+bestAsk) / 2
+	}
+
+	bucket := agg.bucketTicks(ob.Scale, midTicks)
+
+	return OrderBook{
+		Time:        ob.Time,
+		UpdateId:    ob.UpdateId,
+		ReceiveTime: ob.ReceiveTime,
+		Scale:       ob.Scale,
+		Bids:        aggregateDepthLevel(ob.Bids, bucket, floorBucket),
+		Asks:        aggregateDepthLevel(ob.Asks, bucket, ceilBucket),
+	}
+}
@@ -0,0 +1,99 @@
+package orderbook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregate(t *testing.T) {
+	scale := Scale{PriceDecimals: 2, QtyDecimals: 5}
+
+	tests := []struct {
+		name       string
+		agg        Aggregation
+		bids, asks PriceLevelArray
+		wantBids   PriceLevelArray
+		wantAsks   PriceLevelArray
+	}{
+		{
+			// $10 buckets, bids round down and asks up so a bucket on the
+			// boundary stays where it is
+			name:     "absolute",
+			agg:      Aggregation{Size: 10},
+			bids:     PriceLevelArray{{299001, 1}, {299999, 2}, {300000, 3}, {300500, 4}},
+			asks:     PriceLevelArray{{300501, 5}, {301000, 6}, {301001, 7}},
+			wantBids: PriceLevelArray{{299000, 3}, {300000, 7}},
+			wantAsks: PriceLevelArray{{301000, 11}, {302000, 7}},
+		},
+		{
+			// 0.1% of a mid price of 100000 ticks
+			name:     "relative",
+			agg:      Aggregation{Size: 0.1, Relative: true},
+			bids:     PriceLevelArray{{99950, 1}, {99999, 2}},
+			asks:     PriceLevelArray{{100001, 3}, {100150, 4}},
+			wantBids: PriceLevelArray{{99900, 3}},
+			wantAsks: PriceLevelArray{{100100, 3}, {100200, 4}},
+		},
+		{
+			name:     "bucket smaller than a tick",
+			agg:      Aggregation{Size: 0.0001, Relative: true},
+			bids:     PriceLevelArray{{99950, 1}, {99999, 2}},
+			asks:     PriceLevelArray{{100001, 3}},
+			wantBids: PriceLevelArray{{99950, 1}, {99999, 2}},
+			wantAsks: PriceLevelArray{{100001, 3}},
+		},
+		{
+			// without a mid price buckets are a tick wide
+			name:     "relative without asks",
+			agg:      Aggregation{Size: 1, Relative: true},
+			bids:     PriceLevelArray{{99950, 1}, {99999, 2}},
+			asks:     PriceLevelArray{},
+			wantBids: PriceLevelArray{{99950, 1}, {99999, 2}},
+			wantAsks: PriceLevelArray{},
+		},
+	}
+
+	for _, test := range tests {
+		small := OrderBookSmall{Time: 1, Scale: scale, Bids: test.bids, Asks: test.asks}.Aggregate(test.agg)
+		if !reflect.DeepEqual(small.Bids, test.wantBids) || !reflect.DeepEqual(small.Asks, test.wantAsks) {
+			t.Errorf("%s: bids %v asks %v, want %v %v", test.name, small.Bids, small.Asks, test.wantBids, test.wantAsks)
+		}
+
+		// the map book aggregates into the same buckets
+		ob := OrderBook{Time: 1, Scale: scale, Bids: DepthLevel{}, Asks: DepthLevel{}}
+		for _, level := range test.bids {
+			ob.Bids[level[0]] = level[1]
+		}
+		for _, level := range test.asks {
+			ob.Asks[level[0]] = level[1]
+		}
+
+		aggregated := ob.Aggregate(test.agg)
+		if !reflect.DeepEqual(sortedLevels(aggregated.Bids), test.wantBids) || !reflect.DeepEqual(sortedLevels(aggregated.Asks), test.wantAsks) {
+			t.Errorf("%s: map book bids %v asks %v", test.name, aggregated.Bids, aggregated.Asks)
+		}
+	}
+}
+
+func TestParseAggregation(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Aggregation
+	}{
+		{"10", Aggregation{Size: 10}},
+		{"0.5", Aggregation{Size: 0.5}},
+		{"0.1%", Aggregation{Size: 0.1, Relative: true}},
+	}
+
+	for _, test := range tests {
+		if agg, err := ParseAggregation(test.s); err != nil || agg != test.want {
+			t.Errorf("%s: %+v, %v, want %+v", test.s, agg, err, test.want)
+		}
+	}
+
+	for _, s := range []string{"", "0", "-10", "%", "ten", "Inf", "NaN%"} {
+		if _, err := ParseAggregation(s); err == nil {
+			t.Errorf("%s parsed", s)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package orderbook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+
+	"github.com/kelindar/binary"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes the body of a history file in one format. Codecs are looked up
+// by the name they were registered under, which is what FileHeader.Codec, the
+// miner's Format and file extensions refer to.
+type Codec interface {
+	Encode(hist OrderBookHistory) ([]byte, error)
+
+	// NewFrameReader reads everything stored before the diffs into dec and
+	// returns a reader for the diffs that follow.
+	NewFrameReader(r io.Reader, dec *HistDecoder) (FrameReader, error)
+}
+
+type FrameReader interface {
+	// Next decodes the next diff, returning io.EOF once the history is done.
+	Next() (DepthDiff, error)
+}
+
+var codecs = make(map[string]Codec)
+
+// RegisterCodec makes a codec available under name. Codecs register themselves
+// from init, registering the same name twice is a programming error.
+func RegisterCodec(name string, codec Codec) {
+	if _, ok := codecs[name]; ok {
+		log.Fatalf("codec %s is registered twice", name)
+	}
+
+	codecs[name] = codec
+}
+
+func GetCodec(name string) (Codec, error) {
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %s", name)
+	}
+
+	return codec, nil
+}
+
+// CodecNames returns the names of every registered codec in sorted order.
+func CodecNames() []string {
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func init() {
+	RegisterCodec("json", jsonCodec{})
+	RegisterCodec("msgpack", msgPackCodec{})
+	RegisterCodec("bin", binCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(hist OrderBookHistory) ([]byte, error) {
+	return json.Marshal(hist)
+}
+
+func (jsonCodec) NewFrameReader(r io.Reader, dec *HistDecoder) (FrameReader, error) {
+	return newJsonFrameReader(r, dec)
+}
+
+type msgPackCodec struct{}
+
+func (msgPackCodec) Encode(hist OrderBookHistory) ([]byte, error) {
+	return msgpack.Marshal(hist)
+}
+
+func (msgPackCodec) NewFrameReader(r io.Reader, dec *HistDecoder) (FrameReader, error) {
+	return newMsgPackFrameReader(r, dec)
+}
+
+type binCodec struct{}
+
+func (binCodec) Encode(hist OrderBookHistory) ([]byte, error) {
+	return binary.Marshal(hist)
+}
+
+func (binCodec) NewFrameReader(r io.Reader, dec *HistDecoder) (FrameReader, error) {
+	return newBinFrameReader(r, dec)
+}
@@ -0,0 +1,104 @@
+package orderbook
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// benchHistory builds a random walk of a BTCUSDT like book, 5 minutes of 100ms
+// frames with 5000 levels per side.
+func benchHistory() OrderBookHistory {
+	const mid = 3000000
+	random := rand.New(rand.NewSource(1))
+
+	hist := OrderBookHistory{
+		Symbol: "btcusdt",
+		Start: OrderBook{
+			Time:        1700000000000,
+			UpdateId:    40000000000,
+			ReceiveTime: 1700000000020,
+			Scale:       Scale{PriceDecimals: 2, QtyDecimals: 5},
+			Bids:        make(DepthLevel),
+			Asks:        make(DepthLevel),
+		},
+		History: make([]DepthDiff, 3000),
+	}
+
+	for i := 0; i < 5000; i++ {
+		hist.Start.Bids[int64(mid-i)] = random.Int63n(1000000) + 1
+		hist.Start.Asks[int64(mid+1+i)] = random.Int63n(1000000) + 1
+	}
+
+	updateId := hist.Start.UpdateId
+	for i := range hist.History {
+		// binance diffs of 100ms hold a few hundred updates and arrive some
+		// milliseconds after their event time
+		t := hist.Start.Time + int64(100*(i+1))
+		diff := DepthDiff{
+			Time:          t,
+			FirstUpdateId: updateId + 1,
+			LastUpdateId:  updateId + 1 + random.Int63n(400),
+			ReceiveTime:   t + 5 + random.Int63n(30),
+			Bids:          make(DepthLevel),
+			Asks:          make(DepthLevel),
+		}
+		updateId = diff.LastUpdateId
+
+		for k := 0; k < 40; k++ {
+			// changes cluster around the top of the book
+			offset := int64(random.ExpFloat64() * 50)
+			diff.Bids[mid-offset] = random.Int63n(3) * random.Int63n(1000000)
+			diff.Asks[mid+1+offset] = random.Int63n(3) * random.Int63n(1000000)
+		}
+
+		hist.History[i] = diff
+	}
+
+	hist.BuildKeyframes(10 * 30)
+
+	return hist
+}
+
+// BenchmarkEncodeFile and BenchmarkDecodeFile compare every codec with every
+// compression, reporting the size of the file as bytes/file.
+func BenchmarkEncodeFile(b *testing.B) {
+	hist := benchHistory()
+
+	for _, codec := range CodecNames() {
+		for _, compression := range COMPRESSIONS {
+			header := NewFileHeader(hist, codec, "bench")
+			header.Compression = compression
+
+			b.Run(codec+"/"+compression, func(b *testing.B) {
+				var data []byte
+				for i := 0; i < b.N; i++ {
+					data = EncodeFile(hist, header)
+				}
+
+				b.ReportMetric(float64(len(data)), "bytes/file")
+			})
+		}
+	}
+}
+
+func BenchmarkDecodeFile(b *testing.B) {
+	hist := benchHistory()
+
+	for _, codec := range CodecNames() {
+		for _, compression := range COMPRESSIONS {
+			header := NewFileHeader(hist, codec, "bench")
+			header.Compression = compression
+			data := EncodeFile(hist, header)
+
+			b.Run(codec+"/"+compression, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, _, err := DecodeFile(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.ReportMetric(float64(len(data)), "bytes/file")
+			})
+		}
+	}
+}
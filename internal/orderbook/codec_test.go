@@ -0,0 +1,168 @@
+package orderbook
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+var COMPRESSIONS = []string{COMPRESSION_NONE, COMPRESSION_GZIP, COMPRESSION_ZSTD}
+
+// testHistory builds a history of frames diffs 100ms apart, with update ids
+// and receive times like a miner records them.
+func testHistory(frames int) OrderBookHistory {
+	random := rand.New(rand.NewSource(1))
+
+	hist := OrderBookHistory{
+		Symbol: "btcusdt",
+		Start: OrderBook{
+			Time:        1700000000000,
+			UpdateId:    500,
+			ReceiveTime: 1700000000012,
+			Scale:       Scale{PriceDecimals: 2, QtyDecimals: 5},
+			Bids:        DepthLevel{},
+			Asks:        DepthLevel{},
+		},
+		SnapshotUpdateId: 500,
+		GapBefore:        &Gap{Time: 1699999999000, LastUpdateId: 420, NextUpdateId: 450},
+		Gap:              &Gap{Time: 1700000000000 + int64(frames+1)*100, LastUpdateId: 500 + int64(frames)*3, NextUpdateId: 510 + int64(frames)*3},
+	}
+
+	for i := 0; i < 50; i++ {
+		hist.Start.Bids[3000000-int64(i)] = random.Int63n(1000000) + 1
+		hist.Start.Asks[3000001+int64(i)] = random.Int63n(1000000) + 1
+	}
+
+	for i := 0; i < frames; i++ {
+		diff := DepthDiff{
+			Time:          hist.Start.Time + int64(i+1)*100,
+			FirstUpdateId: 501 + int64(i)*3,
+			LastUpdateId:  503 + int64(i)*3,
+			ReceiveTime:   hist.Start.ReceiveTime + int64(i+1)*100 + random.Int63n(20),
+			Bids:          DepthLevel{},
+			Asks:          DepthLevel{},
+		}
+
+		for k := 0; k < 5; k++ {
+			// a quantity of 0 removes the level
+			diff.Bids[3000000-random.Int63n(80)] = random.Int63n(3) * random.Int63n(1000000)
+			diff.Asks[3000001+random.Int63n(80)] = random.Int63n(3) * random.Int63n(1000000)
+		}
+
+		hist.History = append(hist.History, diff)
+	}
+
+	hist.BuildKeyframes(10)
+
+	return hist
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	hist := testHistory(95)
+
+	for _, codec := range CodecNames() {
+		for _, compression := range COMPRESSIONS {
+			header := NewFileHeader(hist, codec, "test")
+			header.Compression = compression
+
+			decodedHeader, decoded, err := DecodeFile(EncodeFile(hist, header))
+			if err != nil {
+				t.Fatalf("%s/%s: %s", codec, compression, err)
+			}
+
+			if decodedHeader.Version != FILE_VERSION || decodedHeader.Codec != codec || decodedHeader.Compression != compression {
+				t.Errorf("%s/%s: header %+v", codec, compression, decodedHeader)
+			}
+
+			if decodedHeader.Scale != hist.Start.Scale || len(decodedHeader.Index) != len(hist.Keyframes)+1 {
+				t.Errorf("%s/%s: header scale %+v, %d index entries", codec, compression, decodedHeader.Scale, len(decodedHeader.Index))
+			}
+
+			if !reflect.DeepEqual(hist, decoded) {
+				t.Errorf("%s/%s: decoded history differs", codec, compression)
+			}
+		}
+	}
+}
+
+func TestCodecRoundTripWithoutKeyframes(t *testing.T) {
+	hist := testHistory(25)
+	hist.BuildKeyframes(0)
+
+	for _, codec := range CodecNames() {
+		_, decoded, err := DecodeFile(EncodeFile(hist, NewFileHeader(hist, codec, "test")))
+		if err != nil {
+			t.Fatalf("%s: %s", codec, err)
+		}
+
+		if !reflect.DeepEqual(hist, decoded) {
+			t.Errorf("%s: decoded history differs", codec)
+		}
+	}
+}
+
+func TestOpenFileAt(t *testing.T) {
+	hist := testHistory(95)
+
+	for _, codec := range CodecNames() {
+		for _, compression := range COMPRESSIONS {
+			header := NewFileHeader(hist, codec, "test")
+			header.Compression = compression
+			data := EncodeFile(hist, header)
+
+			opened := make([]int64, 0)
+			open := func(offset int64) (io.ReadCloser, error) {
+				opened = append(opened, offset)
+				return io.NopCloser(bytes.NewReader(data[offset:])), nil
+			}
+
+			tests := []struct {
+				t     int64
+				frame int
+			}{
+				{hist.Start.Time - 1, 0},
+				{hist.Start.Time, 0},
+				{hist.FrameTime(9), 0},
+				{hist.FrameTime(10), 10},
+				{hist.FrameTime(57), 50},
+				{hist.FrameTime(95) + 1000, 90},
+			}
+
+			for _, test := range tests {
+				opened = opened[:0]
+
+				_, dec, err := OpenFileAt(open, test.t)
+				if err != nil {
+					t.Fatalf("%s/%s at %d: %s", codec, compression, test.t, err)
+				}
+
+				decoded, err := dec.ReadAll()
+				dec.Close()
+				if err != nil {
+					t.Fatalf("%s/%s at %d: %s", codec, compression, test.t, err)
+				}
+
+				if dec.Frame != test.frame {
+					t.Errorf("%s/%s at %d: started at frame %d, want %d", codec, compression, test.t, dec.Frame, test.frame)
+					continue
+				}
+
+				// only the header is read before seeking to the keyframe
+				if test.frame > 0 && (len(opened) != 2 || opened[1] <= opened[0]) {
+					t.Errorf("%s/%s at %d: opened at %v", codec, compression, test.t, opened)
+				}
+
+				want := hist.BookAt(test.frame).ToOrderBook()
+				if !reflect.DeepEqual(decoded.Start.Bids, want.Bids) || !reflect.DeepEqual(decoded.Start.Asks, want.Asks) || decoded.Start.UpdateId != want.UpdateId {
+					t.Errorf("%s/%s at %d: start differs from frame %d", codec, compression, test.t, test.frame)
+				}
+
+				if !reflect.DeepEqual(decoded.History, hist.History[test.frame:]) {
+					t.Errorf("%s/%s at %d: diffs differ", codec, compression, test.t)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package orderbook
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+)
+
+// The "col" codec is a purpose built encoding of histories. Every frame (the
+// start book followed by each diff) is split into columns which are stored one
+// after the other, so similar values sit next to each other:
+//
+//	symbol            uvarint length + bytes
+//	scale             uvarint price decimals, uvarint qty decimals
+//	keyframe interval uvarint, keyframes are not stored, files are split at them
+//	frame count       uvarint
+//	times             varint first time, then varint delta to the previous frame
+//	counts            uvarint bid count, uvarint ask count per frame
+//	prices            per frame and side (bids then asks) in ascending order: the
+//	                  first price as a varint delta from the first price of the
+//	                  same side in the previous frame, then uvarint tick offsets
+//	                  from the previous level
+//	quantities        uvarint lots, 0 removes the level in a diff
+//	update ids        per frame the first update id as a varint delta from the
+//	                  last update id of the previous frame, then the last update
+//	                  id as a varint delta from the first. The start book only
+//	                  has a last update id, it is stored as both
+//	receive times     varint delta to the previous frame
+//
+// The columns are each prefixed with their uvarint length in bytes. Files
+// before FILE_VERSION 2 have no update id and receive time columns.
+//
+// A frame is spread over every column, so the reader can't stream a history
+// and holds it in memory as a whole. Since FILE_VERSION 3 a file is read one
+// segment at a time, which bounds this to the frames between two keyframes,
+// see segment.go. Files written before are read into memory completely.
+
+var errColumnTruncated = errors.New("col: column is truncated")
+
+func init() {
+	RegisterCodec("col", colCodec{})
+}
+
+type colCodec struct{}
+
+func (colCodec) Encode(hist OrderBookHistory) ([]byte, error) {
+	return HistToColumnar(hist), nil
+}
+
+func (colCodec) NewFrameReader(r io.Reader, dec *HistDecoder) (FrameReader, error) {
+	return newColFrameReader(r, dec)
+}
+
+func sortedLevels(dl DepthLevel) PriceLevelArray {
+	levels := make(PriceLevelArray, 0, len(dl))
+	for price, volume := range dl {
+		levels = append(levels, PriceLevel{price, volume})
+	}
+
+	sort.Sort(levels)
+
+	return levels
+}
+
+type colEncoder struct {
+	times, counts, prices, qtys, ids, receives []byte
+
+	lastTime     int64
+	lastFirst    [2]int64
+	lastUpdateId int64
+	lastReceive  int64
+}
+
+func (enc *colEncoder) frame(time, firstUpdateId, lastUpdateId, receiveTime int64, bids, asks DepthLevel) {
+	enc.times = binary.AppendVarint(enc.times, time-enc.lastTime)
+	enc.lastTime = time
+
+	enc.ids = binary.AppendVarint(enc.ids, firstUpdateId-enc.lastUpdateId)
+	enc.ids = binary.AppendVarint(enc.ids, lastUpdateId-firstUpdateId)
+	enc.lastUpdateId = lastUpdateId
+
+	enc.receives = binary.AppendVarint(enc.receives, receiveTime-enc.lastReceive)
+	enc.lastReceive = receiveTime
+
+	for side, dl := range [2]DepthLevel{bids, asks} {
+		levels := sortedLevels(dl)
+		enc.counts = binary.AppendUvarint(enc.counts, uint64(len(levels)))
+
+		for i, level := range levels {
+			if i == 0 {
+				enc.prices = binary.AppendVarint(enc.prices, level[0]-enc.lastFirst[side])
+				enc.lastFirst[side] = level[0]
+			} else {
+				enc.prices = binary.AppendUvarint(enc.prices, uint64(level[0]-levels[i-1][0]))
+			}
+
+			enc.qtys = binary.AppendUvarint(enc.qtys, uint64(level[1]))
+		}
+	}
+}
+
+func appendColumn(buf []byte, column []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(column)))
+	return append(buf, column...)
+}
+
+func HistToColumnar(hist OrderBookHistory) []byte {
+	enc := &colEncoder{}
+
+	start := hist.Start
+	enc.frame(start.Time, start.UpdateId, start.UpdateId, start.ReceiveTime, start.Bids, start.Asks)
+	for _, diff := range hist.History {
+		enc.frame(diff.Time, diff.FirstUpdateId, diff.LastUpdateId, diff.ReceiveTime, diff.Bids, diff.Asks)
+	}
+
+	buf := make([]byte, 0, 48+len(hist.Symbol)+len(enc.times)+len(enc.counts)+len(enc.prices)+len(enc.qtys)+len(enc.ids)+len(enc.receives))
+
+	buf = binary.AppendUvarint(buf, uint64(len(hist.Symbol)))
+	buf = append(buf, hist.Symbol...)
+	buf = binary.AppendUvarint(buf, uint64(hist.Start.Scale.PriceDecimals))
+	buf = binary.AppendUvarint(buf, uint64(hist.Start.Scale.QtyDecimals))
+	buf = binary.AppendUvarint(buf, uint64(hist.KeyframeInterval))
+	buf = binary.AppendUvarint(buf, uint64(len(hist.History)+1))
+
+	buf = appendColumn(buf, enc.times)
+	buf = appendColumn(buf, enc.counts)
+	buf = appendColumn(buf, enc.prices)
+	buf = appendColumn(buf, enc.qtys)
+	buf = appendColumn(buf, enc.ids)
+	buf = appendColumn(buf, enc.receives)
+
+	return buf
+}
+
+// column is a read cursor over one column.
+type column struct {
+	data []byte
+	err  error
+}
+
+func (col *column) uvarint() uint64 {
+	v, n := binary.Uvarint(col.data)
+	if n <= 0 {
+		col.err = errColumnTruncated
+		return 0
+	}
+
+	col.data = col.data[n:]
+	return v
+}
+
+func (col *column) varint() int64 {
+	v, n := binary.Varint(col.data)
+	if n <= 0 {
+		col.err = errColumnTruncated
+		return 0
+	}
+
+	col.data = col.data[n:]
+	return v
+}
+
+func (col *column) next(n uint64) []byte {
+	if uint64(len(col.data)) < n {
+		col.err = errColumnTruncated
+		return nil
+	}
+
+	res := col.data[:n]
+	col.data = col.data[n:]
+	return res
+}
+
+type colFrameReader struct {
+	times, counts, prices, qtys, ids, receives column
+	remaining                                  uint64
+	v1                                         bool
+
+	lastTime     int64
+	lastFirst    [2]int64
+	lastUpdateId int64
+	lastReceive  int64
+}
+
+// columns returns the columns stored in a file of the version being read.
+func (reader *colFrameReader) columns() []*column {
+	if reader.v1 {
+		return []*column{&reader.times, &reader.counts, &reader.prices, &reader.qtys}
+	}
+
+	return []*column{&reader.times, &reader.counts, &reader.prices, &reader.qtys, &reader.ids, &reader.receives}
+}
+
+func (reader *colFrameReader) frame() (DepthDiff, error) {
+	var diff DepthDiff
+
+	reader.lastTime += reader.times.varint()
+	diff.Time = reader.lastTime
+
+	if !reader.v1 {
+		diff.FirstUpdateId = reader.lastUpdateId + reader.ids.varint()
+		diff.LastUpdateId = diff.FirstUpdateId + reader.ids.varint()
+		reader.lastUpdateId = diff.LastUpdateId
+
+		reader.lastReceive += reader.receives.varint()
+		diff.ReceiveTime = reader.lastReceive
+	}
+
+	var sides [2]DepthLevel
+	for side := range sides {
+		n := reader.counts.uvarint()
+		sides[side] = make(DepthLevel, n)
+
+		var price int64
+		for i := uint64(0); i < n; i++ {
+			if i == 0 {
+				price = reader.lastFirst[side] + reader.prices.varint()
+				reader.lastFirst[side] = price
+			} else {
+				price += int64(reader.prices.uvarint())
+			}
+
+			sides[side][price] = int64(reader.qtys.uvarint())
+		}
+	}
+
+	for _, col := range reader.columns() {
+		if col.err != nil {
+			return diff, col.err
+		}
+	}
+
+	diff.Bids, diff.Asks = sides[0], sides[1]
+
+	return diff, nil
+}
+
+func (reader *colFrameReader) Next() (DepthDiff, error) {
+	if reader.remaining == 0 {
+		return DepthDiff{}, io.EOF
+	}
+
+	reader.remaining--
+	return reader.frame()
+}
+
+// newColFrameReader reads the whole encoded history into memory, the columns
+// are only needed one frame at a time but can't be read without each other.
+// Within a file this is a single segment.
+func newColFrameReader(r io.Reader, hist *HistDecoder) (*colFrameReader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &column{data: data}
+
+	hist.Symbol = string(header.next(header.uvarint()))
+	hist.Start.Scale.PriceDecimals = int32(header.uvarint())
+	hist.Start.Scale.QtyDecimals = int32(header.uvarint())
+	hist.KeyframeInterval = int(header.uvarint())
+	frames := header.uvarint()
+
+	reader := &colFrameReader{v1: hist.Version < 2}
+	for _, col := range reader.columns() {
+		col.data = header.next(header.uvarint())
+	}
+
+	if header.err != nil {
+		return nil, header.err
+	} else if frames == 0 {
+		return nil, fmt.Errorf("history has no frames")
+	}
+
+	start, err := reader.frame()
+	if err != nil {
+		return nil, err
+	}
+
+	hist.Start.Time, hist.Start.UpdateId, hist.Start.ReceiveTime = start.Time, start.LastUpdateId, start.ReceiveTime
+	hist.Start.Bids, hist.Start.Asks = start.Bids, start.Asks
+
+	reader.remaining = frames - 1
+
+	return reader, nil
+}
+
+func HistFromColumnar(data []byte) OrderBookHistory {
+	var hist OrderBookHistory
+
+	reader, err := NewHistDecoder(bytes.NewReader(data), "col")
+	if err == nil {
+		hist, err = reader.ReadAll()
+	}
+
+	if err != nil {
+		log.Printf("failed to decode columnar encoding: %s", err)
+	}
+
+	return hist
+}
@@ -0,0 +1,122 @@
+package orderbook
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported compressions of a file body. gzip is the most portable, zstd
+// compresses about as well while being several times faster to decode.
+const (
+	COMPRESSION_NONE = "none"
+	COMPRESSION_GZIP = "gzip"
+	COMPRESSION_ZSTD = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CompressionExtension returns the file extension appended after the format
+// for a compression, e.g. btcusdt/1-2.msgpack.zst.
+func CompressionExtension(compression string) string {
+	switch compression {
+	case COMPRESSION_GZIP:
+		return "gz"
+	case COMPRESSION_ZSTD:
+		return "zst"
+	default:
+		return ""
+	}
+}
+
+// CompressionFromExtension is the inverse of CompressionExtension.
+func CompressionFromExtension(ext string) string {
+	switch ext {
+	case "gz":
+		return COMPRESSION_GZIP
+	case "zst":
+		return COMPRESSION_ZSTD
+	default:
+		return COMPRESSION_NONE
+	}
+}
+
+// Compress compresses data. A level of 0 uses the default level of the
+// compression, otherwise gzip takes levels 1-9 and zstd 1-22.
+func Compress(data []byte, compression string, level int) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	var w io.WriteCloser
+	var err error
+	switch compression {
+	case COMPRESSION_NONE, "":
+		return data, nil
+	case COMPRESSION_GZIP:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		w, err = gzip.NewWriterLevel(buf, level)
+	case COMPRESSION_ZSTD:
+		zstdLevel := zstd.SpeedDefault
+		if level != 0 {
+			zstdLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		w, err = zstd.NewWriter(buf, zstd.WithEncoderLevel(zstdLevel))
+	default:
+		err = fmt.Errorf("unknown compression %s", compression)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// NewDecompressor wraps r in a reader decompressing the given compression.
+func NewDecompressor(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case COMPRESSION_NONE, "":
+		return io.NopCloser(r), nil
+	case COMPRESSION_GZIP:
+		return gzip.NewReader(r)
+	case COMPRESSION_ZSTD:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %s", compression)
+	}
+}
+
+// detectCompression recognises a file that was compressed as a whole (rather
+// than just its body) from its leading magic bytes.
+func detectCompression(r *bufio.Reader) string {
+	if magic, err := r.Peek(len(zstdMagic)); err == nil && bytes.Equal(magic, zstdMagic) {
+		return COMPRESSION_ZSTD
+	}
+
+	if magic, err := r.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		return COMPRESSION_GZIP
+	}
+
+	return COMPRESSION_NONE
+}
@@ -0,0 +1,354 @@
+package orderbook
+
+import (
+	"bufio"
+	encbinary "encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/kelindar/binary"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// HistDecoder reads an OrderBookHistory from a stream one DepthDiff at a time,
+// so a history never has to be held in memory as a whole. Everything stored
+// before History (symbol, start book) is read by NewHistDecoder, the diffs are
+// then read lazily by Next. Keyframes are skipped, they are only useful for
+// random access, files with an index collect the starts of their segments as
+// they are read instead.
+type HistDecoder struct {
+	Symbol           string
+	Start            OrderBook
+	KeyframeInterval int
+
+	// Frame is the frame of the history Start belongs to, not 0 if the
+	// decoder was opened at a keyframe by OpenFileAt.
+	Frame int
+
+	// Keyframes read so far, relative to Start.
+	Keyframes []Keyframe
+
+	// Version is the file version the history was encoded with, codecs whose
+	// layout changed between versions read the body accordingly.
+	Version uint16
+
+	frames  FrameReader
+	closers []io.Closer
+	indexed bool
+}
+
+// NewHistDecoder reads the leading fields of a history encoded with the named
+// codec from r.
+func NewHistDecoder(r io.Reader, format string) (*HistDecoder, error) {
+	return newHistDecoder(r, format, FILE_VERSION)
+}
+
+func newHistDecoder(r io.Reader, format string, version uint16) (*HistDecoder, error) {
+	codec, err := GetCodec(format)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := &HistDecoder{Version: version}
+	dec.frames, err = codec.NewFrameReader(r, dec)
+	if err != nil {
+		return nil, err
+	}
+
+	return dec, nil
+}
+
+// Next returns the next diff of the history or io.EOF after the last one.
+func (dec *HistDecoder) Next() (DepthDiff, error) {
+	return dec.frames.Next()
+}
+
+// Close releases the decompressors opened by OpenFile.
+func (dec *HistDecoder) Close() {
+	closeAll(dec.closers)
+	dec.closers = nil
+}
+
+// ReadAll decodes the remaining diffs into a complete history.
+func (dec *HistDecoder) ReadAll() (OrderBookHistory, error) {
+	hist := OrderBookHistory{
+		Symbol:  dec.Symbol,
+		Start:   dec.Start,
+		History: make([]DepthDiff, 0),
+	}
+
+	for {
+		diff, err := dec.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return hist, err
+		}
+
+		hist.History = append(hist.History, diff)
+	}
+
+	if dec.indexed {
+		hist.KeyframeInterval, hist.Keyframes = dec.KeyframeInterval, dec.Keyframes
+	} else {
+		hist.BuildKeyframes(dec.KeyframeInterval)
+	}
+
+	return hist, nil
+}
+
+// Replay applies every remaining diff to the start book, calling f with the
+// book after each frame (including the start itself) until f returns false.
+// The book passed to f is reused between calls.
+func (dec *HistDecoder) Replay(f func(ob *SortedOrderBook) bool) error {
+	currentOB := dec.Start.ToSortedOrderBook()
+	if !f(currentOB) {
+		return nil
+	}
+
+	for {
+		diff, err := dec.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		currentOB.ApplyDepthDiff(diff)
+		if !f(currentOB) {
+			return nil
+		}
+	}
+}
+
+// json
+
+type jsonFrameReader struct {
+	dec *json.Decoder
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if tok != delim {
+		return fmt.Errorf("expected %s, got %v", delim, tok)
+	}
+
+	return nil
+}
+
+func newJsonFrameReader(r io.Reader, hist *HistDecoder) (*jsonFrameReader, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok {
+		case "Symbol":
+			err = dec.Decode(&hist.Symbol)
+		case "Start":
+			err = dec.Decode(&hist.Start)
+		case "KeyframeInterval":
+			err = dec.Decode(&hist.KeyframeInterval)
+		case "History":
+			if err := expectDelim(dec, '['); err != nil {
+				return nil, err
+			}
+
+			return &jsonFrameReader{dec: dec}, nil
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("history has no frames")
+}
+
+func (reader *jsonFrameReader) Next() (DepthDiff, error) {
+	var diff DepthDiff
+	if !reader.dec.More() {
+		return diff, io.EOF
+	}
+
+	err := reader.dec.Decode(&diff)
+	return diff, err
+}
+
+// msgpack
+
+type msgPackFrameReader struct {
+	dec       *msgpack.Decoder
+	remaining int
+}
+
+func newMsgPackFrameReader(r io.Reader, hist *HistDecoder) (*msgPackFrameReader, error) {
+	dec := msgpack.NewDecoder(bufio.NewReader(r))
+
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < n; i++ {
+		key, err := dec.DecodeString()
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "Symbol":
+			err = dec.Decode(&hist.Symbol)
+		case "Start":
+			err = dec.Decode(&hist.Start)
+		case "KeyframeInterval":
+			err = dec.Decode(&hist.KeyframeInterval)
+		case "History":
+			remaining, err := dec.DecodeArrayLen()
+			if err != nil {
+				return nil, err
+			}
+
+			return &msgPackFrameReader{dec: dec, remaining: remaining}, nil
+		default:
+			err = dec.Skip()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("history has no frames")
+}
+
+func (reader *msgPackFrameReader) Next() (DepthDiff, error) {
+	var diff DepthDiff
+	if reader.remaining <= 0 {
+		return diff, io.EOF
+	}
+
+	reader.remaining--
+	err := reader.dec.Decode(&diff)
+	return diff, err
+}
+
+// bin, the kelindar/binary encoding writes struct fields back to back in
+// declaration order and prefixes slices with their length.
+
+type binFrameReader struct {
+	dec       *binary.Decoder
+	remaining uint64
+	v1        bool
+}
+
+// binStreamReader reads fixed size values with io.ReadFull. The stream reader
+// kelindar/binary falls back to for plain io.Readers fills them with a single
+// Read, which silently truncates values split across buffer boundaries.
+type binStreamReader struct {
+	*bufio.Reader
+}
+
+func (r binStreamReader) Slice(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r.Reader, buf)
+	return buf, err
+}
+
+func (r binStreamReader) ReadUvarint() (uint64, error) {
+	return encbinary.ReadUvarint(r.Reader)
+}
+
+func (r binStreamReader) ReadVarint() (int64, error) {
+	return encbinary.ReadVarint(r.Reader)
+}
+
+func newBinFrameReader(r io.Reader, hist *HistDecoder) (*binFrameReader, error) {
+	dec := binary.NewDecoder(binStreamReader{bufio.NewReader(r)})
+	reader := &binFrameReader{dec: dec, v1: hist.Version < 2}
+
+	var start, keyframes interface{} = &hist.Start, &[]Keyframe{}
+	var startV1 orderBookV1
+	if reader.v1 {
+		start, keyframes = &startV1, &[]keyframeV1{}
+	}
+
+	for _, field := range []interface{}{&hist.Symbol, start, &hist.KeyframeInterval, keyframes} {
+		if err := dec.Decode(field); err != nil {
+			return nil, err
+		}
+	}
+
+	if reader.v1 {
+		hist.Start = startV1.upgrade()
+	}
+
+	var err error
+	if reader.remaining, err = dec.ReadUvarint(); err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func (reader *binFrameReader) Next() (DepthDiff, error) {
+	var diff DepthDiff
+	if reader.remaining == 0 {
+		return diff, io.EOF
+	}
+
+	reader.remaining--
+	if reader.v1 {
+		var diffV1 depthDiffV1
+		err := reader.dec.Decode(&diffV1)
+		return diffV1.upgrade(), err
+	}
+
+	err := reader.dec.Decode(&diff)
+	return diff, err
+}
+
+// Books and diffs of version 1 files have no update ids or receive times. The
+// bin codec relies on the order of struct fields, so version 1 bodies are
+// decoded into copies of the old structs.
+
+type orderBookV1 struct {
+	Time  int64
+	Scale Scale
+	Bids  DepthLevel
+	Asks  DepthLevel
+}
+
+func (ob orderBookV1) upgrade() OrderBook {
+	return OrderBook{Time: ob.Time, Scale: ob.Scale, Bids: ob.Bids, Asks: ob.Asks}
+}
+
+type depthDiffV1 struct {
+	Time int64
+	Bids DepthLevel
+	Asks DepthLevel
+}
+
+func (diff depthDiffV1) upgrade() DepthDiff {
+	return DepthDiff{Time: diff.Time, Bids: diff.Bids, Asks: diff.Asks}
+}
+
+type keyframeV1 struct {
+	Frame int
+	Book  orderBookV1
+}
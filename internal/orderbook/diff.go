@@ -0,0 +1,106 @@
+package orderbook
+
+// diffLevels returns the changes turning from into to, a quantity of 0 removes
+// a level.
+func diffLevels(from, to DepthLevel) DepthLevel {
+	res := make(DepthLevel)
+
+	for price, volume := range to {
+		if old, ok := from[price]; !ok || old != volume {
+			res[price] = volume
+		}
+	}
+
+	for price := range from {
+		if _, ok := to[price]; !ok {
+			res[price] = 0
+		}
+	}
+
+	return res
+}
+
+// Diff returns the DepthDiff that transforms from into to, i.e.
+// from.ApplyDepthDiff(Diff(from, to)) equals to. The diff is empty if the books
+// are the same, which makes Diff usable to compare a reconstructed book against
+// a snapshot. The update ids of the diff span the updates between the books.
+func Diff(from, to OrderBook) DepthDiff {
+	diff := DepthDiff{
+		Time:         to.Time,
+		LastUpdateId: to.UpdateId,
+		ReceiveTime:  to.ReceiveTime,
+		Bids:         diffLevels(from.Bids, to.Bids),
+		Asks:         diffLevels(from.Asks, to.Asks),
+	}
+
+	if to.UpdateId != 0 {
+		diff.FirstUpdateId = from.UpdateId + 1
+	}
+
+	return diff
+}
+
+// IsEmpty reports whether the diff changes no level.
+func (diff DepthDiff) IsEmpty() bool {
+	return len(diff.Bids) == 0 && len(diff.Asks) == 0
+}
+
+// ComposeDiffs merges consecutive diffs into one with the time of the last,
+// applying it has the same effect as applying each diff in order. The update
+// ids span from the first id of the first diff to the last id of the last.
+func ComposeDiffs(diffs ...DepthDiff) DepthDiff {
+	res := DepthDiff{
+		Bids: make(DepthLevel),
+		Asks: make(DepthLevel),
+	}
+
+	if len(diffs) > 0 {
+		res.FirstUpdateId = diffs[0].FirstUpdateId
+	}
+
+	for _, diff := range diffs {
+		res.Time = diff.Time
+		res.LastUpdateId, res.ReceiveTime = diff.LastUpdateId, diff.ReceiveTime
+
+		for price, volume := range diff.Bids {
+			res.Bids[price] = volume
+		}
+
+		for price, volume := range diff.Asks {
+			res.Asks[price] = volume
+		}
+	}
+
+	return res
+}
+
+// Coarsen returns a copy of the history with its diffs composed into one diff
+// per period milliseconds, e.g. 1s diffs from 100ms diffs. Each composed diff
+// has the time of the last diff it contains, periods without diffs are
+// skipped. Keyframes are rebuilt with the same interval.
+func (hist OrderBookHistory) Coarsen(period int64) OrderBookHistory {
+	res := OrderBookHistory{
+		Symbol:           hist.Symbol,
+		Start:            hist.Start,
+		SnapshotUpdateId: hist.SnapshotUpdateId,
+		Gap:              hist.Gap,
+		GapBefore:        hist.GapBefore,
+		History:          make([]DepthDiff, 0, len(hist.History)),
+	}
+
+	for i := 0; i < len(hist.History); {
+		bucket := (hist.History[i].Time - hist.Start.Time) / period
+
+		j := i + 1
+		for j < len(hist.History) && (hist.History[j].Time-hist.Start.Time)/period == bucket {
+			j++
+		}
+
+		res.History = append(res.History, ComposeDiffs(hist.History[i:j]...))
+		i = j
+	}
+
+	res.BuildKeyframes(hist.KeyframeInterval)
+
+	return res
+}
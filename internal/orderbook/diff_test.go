@@ -0,0 +1,80 @@
+package orderbook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	hist := testHistory(100)
+
+	for _, frames := range [][2]int{{0, 1}, {0, 37}, {12, 13}, {40, 100}, {55, 55}} {
+		from, to := hist.BookAt(frames[0]).ToOrderBook(), hist.BookAt(frames[1]).ToOrderBook()
+
+		diff := Diff(from, to)
+		applied := from.Copy()
+		applied.ApplyDepthDiff(diff)
+		if !reflect.DeepEqual(applied, to) {
+			t.Errorf("frames %v: diff doesn't turn one book into the other", frames)
+		}
+
+		if diff.FirstUpdateId != from.UpdateId+1 || diff.LastUpdateId != to.UpdateId {
+			t.Errorf("frames %v: diff from %d to %d", frames, diff.FirstUpdateId, diff.LastUpdateId)
+		}
+
+		if frames[0] == frames[1] {
+			if !diff.IsEmpty() {
+				t.Errorf("frames %v: diff of the same book %+v", frames, diff)
+			}
+			continue
+		}
+
+		composed := ComposeDiffs(hist.History[frames[0]:frames[1]]...)
+		applied = from.Copy()
+		applied.ApplyDepthDiff(composed)
+		if !reflect.DeepEqual(applied, to) {
+			t.Errorf("frames %v: composed diff doesn't turn one book into the other", frames)
+		}
+
+		if composed.FirstUpdateId != hist.History[frames[0]].FirstUpdateId || composed.LastUpdateId != to.UpdateId {
+			t.Errorf("frames %v: composed diff from %d to %d", frames, composed.FirstUpdateId, composed.LastUpdateId)
+		}
+	}
+
+	// books of files without update ids
+	from, to := OrderBook{Bids: DepthLevel{100: 1}, Asks: DepthLevel{}}, OrderBook{Time: 5, Bids: DepthLevel{}, Asks: DepthLevel{101: 2}}
+	want := DepthDiff{Time: 5, Bids: DepthLevel{100: 0}, Asks: DepthLevel{101: 2}}
+	if diff := Diff(from, to); !reflect.DeepEqual(diff, want) {
+		t.Errorf("diff %+v, want %+v", diff, want)
+	}
+}
+
+func TestCoarsen(t *testing.T) {
+	hist := testHistory(95)
+	coarse := hist.Coarsen(1000)
+
+	// diffs at 100ms to 900ms after the start fall into the first second,
+	// then 10 per second
+	if len(coarse.History) != 10 || coarse.KeyframeInterval != hist.KeyframeInterval {
+		t.Fatalf("%d diffs with keyframe interval %d", len(coarse.History), coarse.KeyframeInterval)
+	}
+
+	if coarse.Start.Time != hist.Start.Time || coarse.Gap != hist.Gap || coarse.GapBefore != hist.GapBefore || coarse.SnapshotUpdateId != hist.SnapshotUpdateId {
+		t.Errorf("coarse history %+v doesn't keep the start and gaps", coarse)
+	}
+
+	ob := coarse.Start.Copy()
+	for i, diff := range coarse.History {
+		ob.ApplyDepthDiff(diff)
+
+		// the book after each composed diff is the book at its last diff
+		frame := hist.FrameIndex(diff.Time)
+		if hist.FrameTime(frame) != diff.Time || !reflect.DeepEqual(ob, hist.BookAt(frame).ToOrderBook()) {
+			t.Errorf("coarse frame %d differs from frame %d", i+1, frame)
+		}
+	}
+
+	if got := hist.Coarsen(100); !reflect.DeepEqual(got.History, hist.History) {
+		t.Error("history coarsened to its own period differs")
+	}
+}
@@ -0,0 +1,279 @@
+package orderbook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Every history file starts with a fixed size preamble followed by a JSON
+// encoded FileHeader and then the history itself in the codec named by the
+// header:
+//
+//	magic       4 bytes   "CPKL"
+//	version     uint16    big endian, see FILE_VERSION
+//	header size uint32    big endian
+//	header      JSON FileHeader
+//	body        history encoded with FileHeader.Codec, then compressed with
+//	            FileHeader.Compression
+//
+// A file may also be compressed as a whole, which OpenFile detects from the
+// leading magic bytes of gzip or zstd.
+//
+// Files written before the header was introduced start directly with the body
+// and store prices as float32, see legacy.go.
+//
+// Version 2 added update ids and receive times to books and diffs. The json
+// and msgpack codecs read version 1 bodies as they are, bin and col read them
+// with their version 1 layout, see HistDecoder.Version.
+//
+// Version 3 split the body into independently compressed segments starting at
+// the keyframes of the history, indexed by FileHeader.Index, see segment.go.
+const (
+	FILE_MAGIC   = "CPKL"
+	FILE_VERSION = 3
+
+	preambleSize = 4 + 2 + 4
+)
+
+var ErrLegacyFile = errors.New("file has no header, it was written by a legacy miner and must be migrated")
+
+type FileHeader struct {
+	// Version is read from the preamble and describes the layout of the body.
+	Version uint16 `json:"-"`
+
+	Symbol           string `json:"Symbol"`
+	Codec            string `json:"Codec"`
+	Compression      string `json:"Compression"`
+	CompressionLevel int    `json:"CompressionLevel"`
+	Scale            Scale  `json:"Scale"`
+
+	MinerVersion     string `json:"MinerVersion"`
+	SnapshotUpdateId int64  `json:"SnapshotUpdateId"`
+	Gap              *Gap   `json:"Gap,omitempty"`
+	GapBefore        *Gap   `json:"GapBefore,omitempty"`
+
+	// Index locates the segments of the body, see segment.go.
+	Index []IndexEntry `json:"Index,omitempty"`
+
+	// size is the number of bytes before the body, set by ReadFileHeader
+	size int64
+}
+
+func NewFileHeader(hist OrderBookHistory, codec string, minerVersion string) FileHeader {
+	return FileHeader{
+		Version:          FILE_VERSION,
+		Symbol:           hist.Symbol,
+		Codec:            codec,
+		Compression:      COMPRESSION_NONE,
+		Scale:            hist.Start.Scale,
+		MinerVersion:     minerVersion,
+		SnapshotUpdateId: hist.SnapshotUpdateId,
+		Gap:              hist.Gap,
+		GapBefore:        hist.GapBefore,
+	}
+}
+
+func writeFileHeader(w io.Writer, header FileHeader) error {
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	preamble := make([]byte, preambleSize)
+	copy(preamble, FILE_MAGIC)
+	binary.BigEndian.PutUint16(preamble[4:], FILE_VERSION)
+	binary.BigEndian.PutUint32(preamble[6:], uint32(len(headerBytes)))
+
+	if _, err := w.Write(preamble); err != nil {
+		return err
+	}
+
+	_, err = w.Write(headerBytes)
+	return err
+}
+
+// ReadFileHeader reads the header at the start of r. It returns ErrLegacyFile
+// without consuming anything if the file has no header.
+func ReadFileHeader(r *bufio.Reader) (FileHeader, error) {
+	var header FileHeader
+
+	preamble, err := r.Peek(preambleSize)
+	if err == io.EOF || err == bufio.ErrBufferFull || (err == nil && string(preamble[:4]) != FILE_MAGIC) {
+		return header, ErrLegacyFile
+	} else if err != nil {
+		return header, err
+	}
+
+	r.Discard(preambleSize)
+
+	header.Version = binary.BigEndian.Uint16(preamble[4:])
+	if header.Version > FILE_VERSION {
+		return header, fmt.Errorf("file version %d is newer than supported version %d", header.Version, FILE_VERSION)
+	}
+
+	headerBytes := make([]byte, binary.BigEndian.Uint32(preamble[6:]))
+	if _, err := io.ReadFull(r, headerBytes); err != nil {
+		return header, err
+	}
+	header.size = int64(preambleSize + len(headerBytes))
+
+	err = json.Unmarshal(headerBytes, &header)
+	return header, err
+}
+
+// EncodeFile encodes hist with its header prepended, compressing the body as
+// set in the header. The index of the header is set from the keyframes of
+// hist.
+func EncodeFile(hist OrderBookHistory, header FileHeader) []byte {
+	codec, err := GetCodec(header.Codec)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	body, index, err := encodeSegments(hist, codec, header.Compression, header.CompressionLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	header.Index = index
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(body)+256))
+	if err := writeFileHeader(buf, header); err != nil {
+		log.Fatal(err)
+	}
+	buf.Write(body)
+
+	return buf.Bytes()
+}
+
+// OpenFile reads the header of a history file and returns a decoder for the
+// frames that follow it. The decoder must be closed once done.
+func OpenFile(r io.Reader) (FileHeader, *HistDecoder, error) {
+	var header FileHeader
+
+	br := bufio.NewReader(r)
+	closers := make([]io.Closer, 0, 2)
+
+	if outer := detectCompression(br); outer != COMPRESSION_NONE {
+		rc, err := NewDecompressor(br, outer)
+		if err != nil {
+			return header, nil, err
+		}
+
+		closers = append(closers, rc)
+		br = bufio.NewReader(rc)
+	}
+
+	header, err := ReadFileHeader(br)
+	if err != nil {
+		closeAll(closers)
+		return header, nil, err
+	}
+
+	dec, err := openBody(br, header, 0, closers)
+	return header, dec, err
+}
+
+// OpenFileAt is OpenFile for files that can be read from any offset, the
+// returned decoder starts at the last keyframe at or before t instead of the
+// start of the history. Files without an index, or compressed as a whole, are
+// read from the start.
+func OpenFileAt(open func(offset int64) (io.ReadCloser, error), t int64) (FileHeader, *HistDecoder, error) {
+	var header FileHeader
+
+	rc, err := open(0)
+	if err != nil {
+		return header, nil, err
+	}
+
+	br := bufio.NewReader(rc)
+	if detectCompression(br) != COMPRESSION_NONE {
+		header, dec, err := OpenFile(br)
+		if err != nil {
+			rc.Close()
+			return header, nil, err
+		}
+
+		dec.closers = append([]io.Closer{rc}, dec.closers...)
+		return header, dec, nil
+	}
+
+	header, err = ReadFileHeader(br)
+	if err != nil {
+		rc.Close()
+		return header, nil, err
+	}
+
+	k := header.segmentAt(t)
+	if k > 0 {
+		rc.Close()
+
+		rc, err = open(header.size + header.Index[k].Offset)
+		if err != nil {
+			return header, nil, err
+		}
+		br = bufio.NewReader(rc)
+	}
+
+	dec, err := openBody(br, header, k, []io.Closer{rc})
+	return header, dec, err
+}
+
+// openBody returns a decoder for the body of a file positioned at segment k,
+// closing closers once done.
+func openBody(br *bufio.Reader, header FileHeader, k int, closers []io.Closer) (*HistDecoder, error) {
+	if len(header.Index) > 0 {
+		dec := &HistDecoder{Version: header.Version, indexed: true}
+
+		segments, err := newSegmentReader(br, header, k, dec)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+
+		dec.frames, dec.closers = segments, append(closers, segments)
+		return dec, nil
+	}
+
+	body, err := NewDecompressor(br, header.Compression)
+	if err != nil {
+		closeAll(closers)
+		return nil, err
+	}
+	closers = append(closers, body)
+
+	dec, err := newHistDecoder(body, header.Codec, header.Version)
+	if err != nil {
+		closeAll(closers)
+		return nil, err
+	}
+
+	dec.closers = closers
+
+	return dec, nil
+}
+
+func closeAll(closers []io.Closer) {
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i].Close()
+	}
+}
+
+// DecodeFile decodes a complete history file.
+func DecodeFile(data []byte) (FileHeader, OrderBookHistory, error) {
+	header, dec, err := OpenFile(bytes.NewReader(data))
+	if err != nil {
+		return header, OrderBookHistory{}, err
+	}
+	defer dec.Close()
+
+	hist, err := dec.ReadAll()
+	hist.SnapshotUpdateId, hist.Gap, hist.GapBefore = header.SnapshotUpdateId, header.Gap, header.GapBefore
+
+	return header, hist, err
+}
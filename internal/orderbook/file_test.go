@@ -0,0 +1,229 @@
+package orderbook
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	kelindar "github.com/kelindar/binary"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// The bodies below are written like the miner wrote files of their version,
+// so the decoders have to keep reading them whatever the current layout is.
+
+// Books and diffs as version 1 files stored them in bin and msgpack.
+type testBookV1 struct {
+	Time  int64
+	Scale Scale
+	Bids  DepthLevel
+	Asks  DepthLevel
+}
+
+type testDiffV1 struct {
+	Time int64
+	Bids DepthLevel
+	Asks DepthLevel
+}
+
+type testKeyframeV1 struct {
+	Frame int
+	Book  testBookV1
+}
+
+type testHistoryV1 struct {
+	Symbol           string
+	Start            testBookV1
+	KeyframeInterval int
+	Keyframes        []testKeyframeV1
+	History          []testDiffV1
+}
+
+const (
+	JSON_V1 = `{"Symbol":"btcusdt",
+		"Start":{"Time":1000,"Scale":{"PriceDecimals":2,"QtyDecimals":5},"Bids":{"100":"5"},"Asks":{"101":"7"}},
+		"KeyframeInterval":2,"Keyframes":[],
+		"History":[
+			{"Time":1100,"Bids":{"99":"3","100":"0"},"Asks":{}},
+			{"Time":1200,"Bids":{},"Asks":{"101":"0","102":"1"}}]}`
+
+	JSON_V2 = `{"Symbol":"btcusdt",
+		"Start":{"Time":1000,"UpdateId":10,"ReceiveTime":1010,"Scale":{"PriceDecimals":2,"QtyDecimals":5},"Bids":{"100":"5"},"Asks":{"101":"7"}},
+		"KeyframeInterval":2,"Keyframes":[],
+		"History":[
+			{"Time":1100,"FirstUpdateId":11,"LastUpdateId":13,"ReceiveTime":1112,"Bids":{"99":"3","100":"0"},"Asks":{}},
+			{"Time":1200,"FirstUpdateId":14,"LastUpdateId":14,"ReceiveTime":1205,"Bids":{},"Asks":{"101":"0","102":"1"}}]}`
+)
+
+// versionedHistory is the history every body below decodes to, without the
+// update ids and receive times of version 2 if v1 is set.
+func versionedHistory(v1 bool) OrderBookHistory {
+	hist := OrderBookHistory{
+		Symbol: "btcusdt",
+		Start: OrderBook{
+			Time:        1000,
+			UpdateId:    10,
+			ReceiveTime: 1010,
+			Scale:       Scale{PriceDecimals: 2, QtyDecimals: 5},
+			Bids:        DepthLevel{100: 5},
+			Asks:        DepthLevel{101: 7},
+		},
+		History: []DepthDiff{
+			{Time: 1100, FirstUpdateId: 11, LastUpdateId: 13, ReceiveTime: 1112, Bids: DepthLevel{99: 3, 100: 0}, Asks: DepthLevel{}},
+			{Time: 1200, FirstUpdateId: 14, LastUpdateId: 14, ReceiveTime: 1205, Bids: DepthLevel{}, Asks: DepthLevel{101: 0, 102: 1}},
+		},
+	}
+
+	if v1 {
+		hist.Start.UpdateId, hist.Start.ReceiveTime = 0, 0
+		for i := range hist.History {
+			hist.History[i].FirstUpdateId, hist.History[i].LastUpdateId, hist.History[i].ReceiveTime = 0, 0, 0
+		}
+	}
+
+	hist.BuildKeyframes(2)
+
+	return hist
+}
+
+// historyV1 reads JSON_V1 into the version 1 structs, with the keyframe the
+// miner stored in bin and msgpack files.
+func historyV1() testHistoryV1 {
+	var hist testHistoryV1
+	if err := json.Unmarshal([]byte(JSON_V1), &hist); err != nil {
+		panic(err)
+	}
+
+	hist.Keyframes = []testKeyframeV1{
+		{2, testBookV1{Time: 1200, Scale: hist.Start.Scale, Bids: DepthLevel{99: 3}, Asks: DepthLevel{102: 1}}},
+	}
+
+	return hist
+}
+
+func (hist testHistoryV1) encode(codec string) []byte {
+	var data []byte
+	var err error
+	if codec == "bin" {
+		data, err = kelindar.Marshal(hist)
+	} else {
+		data, err = msgpack.Marshal(hist)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// colBody writes the columns of the history by hand, with the update id and
+// receive time columns unless v1 is set.
+func colBody(v1 bool) []byte {
+	uvarints := func(values ...uint64) []byte {
+		res := make([]byte, 0)
+		for _, v := range values {
+			res = binary.AppendUvarint(res, v)
+		}
+		return res
+	}
+	varints := func(values ...int64) []byte {
+		res := make([]byte, 0)
+		for _, v := range values {
+			res = binary.AppendVarint(res, v)
+		}
+		return res
+	}
+
+	body := uvarints(7)
+	body = append(body, "btcusdt"...)
+	body = append(body, uvarints(2, 5, 2, 3)...)
+
+	// bids then asks of every frame, the first price relative to the first
+	// price of the side in the frame before
+	prices := varints(100, 101, -1)
+	prices = append(prices, uvarints(1)...)
+	prices = append(prices, varints(0)...)
+	prices = append(prices, uvarints(1)...)
+
+	columns := [][]byte{varints(1000, 100, 100), uvarints(1, 1, 2, 0, 0, 2), prices, uvarints(5, 7, 3, 0, 0, 1)}
+	if !v1 {
+		columns = append(columns, varints(10, 0, 1, 2, 1, 0), varints(1010, 102, 93))
+	}
+
+	for _, column := range columns {
+		body = append(body, uvarints(uint64(len(column)))...)
+		body = append(body, column...)
+	}
+
+	return body
+}
+
+// versionedFile prepends a header of the given version to body. Files before
+// version 3 have no index.
+func versionedFile(version uint16, codec, compression string, body []byte) []byte {
+	header, err := json.Marshal(FileHeader{Symbol: "btcusdt", Codec: codec, Compression: compression, Scale: Scale{PriceDecimals: 2, QtyDecimals: 5}})
+	if err != nil {
+		panic(err)
+	}
+
+	if body, err = Compress(body, compression, 0); err != nil {
+		panic(err)
+	}
+
+	data := []byte(FILE_MAGIC)
+	data = binary.BigEndian.AppendUint16(data, version)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(header)))
+	data = append(data, header...)
+
+	return append(data, body...)
+}
+
+func TestDecodeVersions(t *testing.T) {
+	binV2, err := binCodec{}.Encode(versionedHistory(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgPackV2, err := msgPackCodec{}.Encode(versionedHistory(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1, v2 := versionedHistory(true), versionedHistory(false)
+	tests := []struct {
+		version     uint16
+		codec       string
+		compression string
+		body        []byte
+		want        OrderBookHistory
+	}{
+		{1, "json", COMPRESSION_NONE, []byte(JSON_V1), v1},
+		{1, "msgpack", COMPRESSION_NONE, historyV1().encode("msgpack"), v1},
+		{1, "bin", COMPRESSION_NONE, historyV1().encode("bin"), v1},
+		{1, "col", COMPRESSION_NONE, colBody(true), v1},
+		{1, "col", COMPRESSION_GZIP, colBody(true), v1},
+		{2, "json", COMPRESSION_NONE, []byte(JSON_V2), v2},
+		{2, "msgpack", COMPRESSION_NONE, msgPackV2, v2},
+		{2, "bin", COMPRESSION_NONE, binV2, v2},
+		{2, "col", COMPRESSION_NONE, colBody(false), v2},
+		{2, "col", COMPRESSION_ZSTD, colBody(false), v2},
+	}
+
+	for _, test := range tests {
+		header, hist, err := DecodeFile(versionedFile(test.version, test.codec, test.compression, test.body))
+		if err != nil {
+			t.Errorf("v%d %s/%s: %s", test.version, test.codec, test.compression, err)
+			continue
+		}
+
+		if header.Version != test.version {
+			t.Errorf("v%d %s/%s: read version %d", test.version, test.codec, test.compression, header.Version)
+		}
+
+		if !reflect.DeepEqual(hist, test.want) {
+			t.Errorf("v%d %s/%s: decoded %+v, want %+v", test.version, test.codec, test.compression, hist, test.want)
+		}
+	}
+}
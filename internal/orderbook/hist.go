@@ -9,11 +9,39 @@ import (
 )
 
 type OrderBookHistory struct {
-	Symbol  string      `json:"Symbol"`
-	Start   OrderBook   `json:"Start"`
+	Symbol string    `json:"Symbol"`
+	Start  OrderBook `json:"Start"`
+
+	// SnapshotUpdateId is the exchange update id of the REST snapshot the
+	// history was built from. It is stored in the FileHeader, not the body.
+	SnapshotUpdateId int64 `json:"-" msgpack:"-" binary:"-"`
+
+	// Gap is set if the history was cut short by a gap in the exchange
+	// stream. It is stored in the FileHeader, not the body.
+	Gap *Gap `json:"-" msgpack:"-" binary:"-"`
+
+	// GapBefore is set if diffs were lost before the start of the history
+	// and no stored history ends in the gap, because the history it cut short
+	// was too short to be stored. It is stored in the FileHeader, not the body.
+	GapBefore *Gap `json:"-" msgpack:"-" binary:"-"`
+
+	// KeyframeInterval is the number of frames between keyframes, 0 if the
+	// history has none. See BuildKeyframes.
+	KeyframeInterval int        `json:"KeyframeInterval"`
+	Keyframes        []Keyframe `json:"Keyframes"`
+
 	History []DepthDiff `json:"History"`
 }
 
+// Gap records a break in the update ids of an exchange stream, i.e. diffs
+// were lost. A history ending in a gap stops at its last correct frame, the
+// next history starts from a new snapshot.
+type Gap struct {
+	Time         int64 `json:"Time"`         // time of the first diff after the gap
+	LastUpdateId int64 `json:"LastUpdateId"` // last update id applied before the gap
+	NextUpdateId int64 `json:"NextUpdateId"` // first update id after the gap, 0 if unknown
+}
+
 func (hist *OrderBookHistory) GetStartTime() int64 {
 	return hist.History[0].Time
 }
@@ -86,21 +114,27 @@ func HistFromBytes(data []byte) OrderBookHistory {
 	return hist
 }
 
+// MAX_DEPTH is the number of levels per side kept when reconstructing sorted
+// frames, matching the depth of the snapshots the miner requests.
+const MAX_DEPTH = 5000
+
+// ToSmallArray reconstructs every frame of the history. With sort set each
+// frame is cut to the best MAX_DEPTH levels per side in SortAndCut order,
+// otherwise every level is returned.
 func (hist OrderBookHistory) ToSmallArray(sort bool) []OrderBookSmall {
 	obs := make([]OrderBookSmall, len(hist.History)+1)
 
-	currentOB := hist.Start
-	obs[0] = currentOB.ToOrderBookSmall()
+	limit := -1
 	if sort {
-		obs[0].SortAndCut(5000)
+		limit = MAX_DEPTH
 	}
 
+	currentOB := hist.Start.ToSortedOrderBook()
+	obs[0] = currentOB.ToOrderBookSmall(limit)
+
 	for i, diff := range hist.History {
 		currentOB.ApplyDepthDiff(diff)
-		obs[i+1] = currentOB.ToOrderBookSmall()
-		if sort {
-			obs[i+1].SortAndCut(5000)
-		}
+		obs[i+1] = currentOB.ToOrderBookSmall(limit)
 	}
 
 	return obs
@@ -0,0 +1,111 @@
+package orderbook
+
+import "sort"
+
+// Keyframe is a full copy of the book embedded in a history every
+// KeyframeInterval frames. Frame is the index of the frame the book belongs to
+// (0 is Start, i is the book after applying History[i-1]), so the keyframes
+// double as the frame offset table used for seeking.
+type Keyframe struct {
+	Frame int
+	Book  OrderBook
+}
+
+func (ob OrderBook) Copy() OrderBook {
+	cp := OrderBook{
+		Time:        ob.Time,
+		UpdateId:    ob.UpdateId,
+		ReceiveTime: ob.ReceiveTime,
+		Scale:       ob.Scale,
+		Bids:        make(DepthLevel, len(ob.Bids)),
+		Asks:        make(DepthLevel, len(ob.Asks)),
+	}
+
+	for price, volume := range ob.Bids {
+		cp.Bids[price] = volume
+	}
+
+	for price, volume := range ob.Asks {
+		cp.Asks[price] = volume
+	}
+
+	return cp
+}
+
+// BuildKeyframes replaces the keyframes of the history with a snapshot every
+// interval frames. An interval of 0 or less removes all keyframes.
+func (hist *OrderBookHistory) BuildKeyframes(interval int) {
+	hist.KeyframeInterval = interval
+	hist.Keyframes = nil
+
+	if interval <= 0 {
+		return
+	}
+
+	hist.Keyframes = make([]Keyframe, 0, len(hist.History)/interval)
+
+	currentOB := hist.Start.Copy()
+	for i, diff := range hist.History {
+		currentOB.ApplyDepthDiff(diff)
+
+		if (i+1)%interval == 0 {
+			hist.Keyframes = append(hist.Keyframes, Keyframe{Frame: i + 1, Book: currentOB.Copy()})
+		}
+	}
+}
+
+// Len returns the number of frames in the history, including Start.
+func (hist *OrderBookHistory) Len() int {
+	return len(hist.History) + 1
+}
+
+// FrameTime returns the time of frame i.
+func (hist *OrderBookHistory) FrameTime(i int) int64 {
+	if i == 0 {
+		return hist.Start.Time
+	}
+
+	return hist.History[i-1].Time
+}
+
+// FrameIndex returns the index of the last frame at or before t, or -1 if t is
+// before the start of the history.
+func (hist *OrderBookHistory) FrameIndex(t int64) int {
+	return sort.Search(hist.Len(), func(i int) bool {
+		return hist.FrameTime(i) > t
+	}) - 1
+}
+
+// BookAt reconstructs the book at frame i from the closest preceding keyframe,
+// replaying at most KeyframeInterval diffs.
+func (hist *OrderBookHistory) BookAt(i int) *SortedOrderBook {
+	k := sort.Search(len(hist.Keyframes), func(k int) bool {
+		return hist.Keyframes[k].Frame > i
+	}) - 1
+
+	var currentOB *SortedOrderBook
+	frame := 0
+	if k >= 0 {
+		currentOB = hist.Keyframes[k].Book.ToSortedOrderBook()
+		frame = hist.Keyframes[k].Frame
+	} else {
+		currentOB = hist.Start.ToSortedOrderBook()
+	}
+
+	for ; frame < i; frame++ {
+		currentOB.ApplyDepthDiff(hist.History[frame])
+	}
+
+	return currentOB
+}
+
+// BookAtTime returns the book as it was at time t. It returns false if t is before
+// the start of the history.
+func (hist *OrderBookHistory) BookAtTime(t int64) (*SortedOrderBook, bool) {
+	i := hist.FrameIndex(t)
+	if i < 0 {
+		return nil, false
+	}
+
+	return hist.BookAt(i), true
+}
@@ -0,0 +1,123 @@
+package orderbook
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/kelindar/binary"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Legacy histories were written without a FileHeader, with prices and
+// quantities stored as float32 and without keyframes. They can only be read to
+// be migrated to the current format.
+
+type legacyDepthLevel map[float32]float32
+
+type legacyOrderBook struct {
+	Time int64
+	Bids legacyDepthLevel
+	Asks legacyDepthLevel
+}
+
+type legacyDepthDiff struct {
+	Time int64
+	Bids legacyDepthLevel
+	Asks legacyDepthLevel
+}
+
+type LegacyOrderBookHistory struct {
+	Symbol  string            `json:"Symbol"`
+	Start   legacyOrderBook   `json:"Start"`
+	History []legacyDepthDiff `json:"History"`
+}
+
+func (dl *legacyDepthLevel) UnmarshalJSON(data []byte) error {
+	var dlString map[string]string
+	err := json.Unmarshal(data, &dlString)
+	if err != nil {
+		return err
+	}
+
+	if *dl == nil {
+		*dl = make(legacyDepthLevel, len(dlString))
+	}
+
+	for key, value := range dlString {
+		key_f, err := strconv.ParseFloat(key, 32)
+		if err != nil {
+			return err
+		}
+
+		value_f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return err
+		}
+
+		(*dl)[float32(key_f)] = float32(value_f)
+	}
+
+	return nil
+}
+
+// DecodeLegacy decodes a headerless history. The format has to be taken from
+// the file extension.
+func DecodeLegacy(data []byte, format string) (LegacyOrderBookHistory, error) {
+	var hist LegacyOrderBookHistory
+	if len(data) == 0 {
+		return hist, fmt.Errorf("file is empty")
+	}
+
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &hist)
+	case "msgpack":
+		err = msgpack.Unmarshal(data, &hist)
+	case "bin":
+		err = binary.Unmarshal(data, &hist)
+	default:
+		err = fmt.Errorf("unknown format %s", format)
+	}
+
+	return hist, err
+}
+
+func (dl legacyDepthLevel) upgrade(scale Scale) DepthLevel {
+	priceMul, qtyMul := math.Pow10(int(scale.PriceDecimals)), math.Pow10(int(scale.QtyDecimals))
+
+	res := make(DepthLevel, len(dl))
+	for price, volume := range dl {
+		res[int64(math.Round(float64(price)*priceMul))] = int64(math.Round(float64(volume) * qtyMul))
+	}
+
+	return res
+}
+
+// Upgrade converts the history to fixed point by rounding every price and
+// quantity to the given scale. Precision the float32 values had already lost
+// can not be recovered.
+func (hist LegacyOrderBookHistory) Upgrade(scale Scale) OrderBookHistory {
+	res := OrderBookHistory{
+		Symbol: hist.Symbol,
+		Start: OrderBook{
+			Time:  hist.Start.Time,
+			Scale: scale,
+			Bids:  hist.Start.Bids.upgrade(scale),
+			Asks:  hist.Start.Asks.upgrade(scale),
+		},
+		History: make([]DepthDiff, len(hist.History)),
+	}
+
+	for i, diff := range hist.History {
+		res.History[i] = DepthDiff{
+			Time: diff.Time,
+			Bids: diff.Bids.upgrade(scale),
+			Asks: diff.Asks.upgrade(scale),
+		}
+	}
+
+	return res
+}
@@ -5,22 +5,45 @@ import (
 	"strconv"
 )
 
-type DepthLevel map[float32]float32
+// DepthLevel maps a price in ticks to a quantity in lots. See Scale for how
+// ticks and lots convert back to decimal values.
+type DepthLevel map[int64]int64
 
 type OrderBook struct {
 	Time int64
-	Bids DepthLevel
-	Asks DepthLevel
+
+	// UpdateId is the last exchange update id the book reflects and
+	// ReceiveTime the local time in ms the update was received at, both
+	// taken from the last diff applied. They are 0 in files written before
+	// FILE_VERSION 2.
+	UpdateId    int64
+	ReceiveTime int64
+
+	Scale Scale
+	Bids  DepthLevel
+	Asks  DepthLevel
 }
 
 type DepthDiff struct {
 	Time int64
+
+	// FirstUpdateId and LastUpdateId are the first and last exchange update
+	// ids the diff contains, so consecutive diffs continue each other if
+	// FirstUpdateId is the LastUpdateId of the previous one plus 1.
+	// ReceiveTime is the local time in ms the diff was received at, Time is
+	// set by the exchange. All of them are 0 in files written before
+	// FILE_VERSION 2.
+	FirstUpdateId int64
+	LastUpdateId  int64
+	ReceiveTime   int64
+
 	Bids DepthLevel
 	Asks DepthLevel
 }
 
 func (ob *OrderBook) ApplyDepthDiff(diff DepthDiff) OrderBook {
 	ob.Time = diff.Time
+	ob.UpdateId, ob.ReceiveTime = diff.LastUpdateId, diff.ReceiveTime
 
 	for price, volume := range diff.Bids {
 		if volume == 0 {
@@ -44,22 +67,36 @@ func (ob *OrderBook) ApplyDepthDiff(diff DepthDiff) OrderBook {
 func (dl DepthLevel) MarshalJSON() ([]byte, error) {
 	dlString := make(map[string]string)
 	for key, value := range dl {
-		dlString[strconv.FormatFloat(float64(key), 'E', -1, 32)] = strconv.FormatFloat(float64(value), 'E', -1, 32)
+		dlString[strconv.FormatInt(key, 10)] = strconv.FormatInt(value, 10)
 	}
 
 	return json.Marshal(dlString)
 }
 
-func (dl DepthLevel) UnmarshalJSON(data []byte) error {
+func (dl *DepthLevel) UnmarshalJSON(data []byte) error {
 	var dlString map[string]string
 	err := json.Unmarshal(data, &dlString)
+	if err != nil {
+		return err
+	}
+
+	if *dl == nil {
+		*dl = make(DepthLevel, len(dlString))
+	}
 
 	for key, value := range dlString {
-		key_f, _ := strconv.ParseFloat(key, 32)
-		value_f, _ := strconv.ParseFloat(value, 32)
+		key_i, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		value_i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
 
-		dl[float32(key_f)] = float32(value_f)
+		(*dl)[key_i] = value_i
 	}
 
-	return err
+	return nil
 }
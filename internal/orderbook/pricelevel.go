@@ -1,6 +1,7 @@
 package orderbook
 
-type PriceLevel [2]float32
+// PriceLevel holds a price in ticks and a quantity in lots.
+type PriceLevel [2]int64
 type PriceLevelArray []PriceLevel
 
 func (pla PriceLevelArray) Len() int {
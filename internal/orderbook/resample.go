@@ -0,0 +1,119 @@
+package orderbook
+
+import "fmt"
+
+// Modes of a Resampler, deciding which frame is sampled at a grid time t.
+const (
+	// RESAMPLE_LAST samples the last frame at or before t, the state of the
+	// book at t.
+	RESAMPLE_LAST = "last"
+	// RESAMPLE_FIRST_AFTER samples the first frame at or after t.
+	RESAMPLE_FIRST_AFTER = "first-after"
+	// RESAMPLE_SKIP_UNCHANGED samples like RESAMPLE_LAST but drops samples
+	// equal to the previous one.
+	RESAMPLE_SKIP_UNCHANGED = "skip-unchanged"
+)
+
+// Resampler samples a stream of frames on a fixed time grid of Period
+// milliseconds, independent of how regular the frames are. Samples are
+// relabelled with their grid time. Frames have to be added in time order.
+type Resampler struct {
+	Period int64
+	Mode   string
+
+	next    int64
+	prev    OrderBookSmall
+	hasPrev bool
+
+	emitted    OrderBookSmall
+	hasEmitted bool
+}
+
+// NewResampler starts the grid at start, or at the first frame if start is 0.
+func NewResampler(start, period int64, mode string) (*Resampler, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("resampling period must be positive")
+	}
+
+	switch mode {
+	case RESAMPLE_LAST, RESAMPLE_FIRST_AFTER, RESAMPLE_SKIP_UNCHANGED:
+		return &Resampler{Period: period, Mode: mode, next: start}, nil
+	default:
+		return nil, fmt.Errorf("unknown resampling mode %s", mode)
+	}
+}
+
+func sameLevels(a, b PriceLevelArray) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Resampler) sample(res []OrderBookSmall, ob OrderBookSmall) []OrderBookSmall {
+	ob.Time = r.next
+	r.next += r.Period
+
+	if r.Mode == RESAMPLE_SKIP_UNCHANGED {
+		if r.hasEmitted && sameLevels(r.emitted.Bids, ob.Bids) && sameLevels(r.emitted.Asks, ob.Asks) {
+			return res
+		}
+
+		r.emitted, r.hasEmitted = ob, true
+	}
+
+	return append(res, ob)
+}
+
+// Add returns the samples that are known once obs have been seen.
+func (r *Resampler) Add(obs []OrderBookSmall) []OrderBookSmall {
+	res := make([]OrderBookSmall, 0, len(obs))
+
+	for _, ob := range obs {
+		if r.next == 0 {
+			r.next = ob.Time
+		}
+
+		if r.Mode == RESAMPLE_FIRST_AFTER {
+			for r.next <= ob.Time {
+				res = r.sample(res, ob)
+			}
+		} else if !r.hasPrev {
+			// skip the grid times before the first frame, the book isn't known there
+			if r.next < ob.Time {
+				r.next += (ob.Time - r.next + r.Period - 1) / r.Period * r.Period
+			}
+		} else {
+			for r.next < ob.Time {
+				res = r.sample(res, r.prev)
+			}
+		}
+
+		r.prev, r.hasPrev = ob, true
+	}
+
+	return res
+}
+
+// Flush returns the remaining samples up to end. The last frame is assumed to
+// hold until end, so end must not be later than the time up to which the book
+// is known. There is nothing left to sample for RESAMPLE_FIRST_AFTER.
+func (r *Resampler) Flush(end int64) []OrderBookSmall {
+	res := make([]OrderBookSmall, 0)
+	if r.Mode == RESAMPLE_FIRST_AFTER || !r.hasPrev {
+		return res
+	}
+
+	for r.next <= end {
+		res = r.sample(res, r.prev)
+	}
+
+	return res
+}
@@ -0,0 +1,77 @@
+package orderbook
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResampler(t *testing.T) {
+	// frames told apart by their bid, the last one doesn't change the book
+	frame := func(time, bid int64) OrderBookSmall {
+		return OrderBookSmall{Time: time, Bids: PriceLevelArray{{bid, 1}}, Asks: PriceLevelArray{{10, 1}}}
+	}
+	frames := []OrderBookSmall{frame(1000, 1), frame(1250, 2), frame(1500, 3), frame(1800, 3)}
+
+	tests := []struct {
+		name  string
+		mode  string
+		start int64
+		end   int64
+		want  [][2]int64 // grid time and bid of the samples
+	}{
+		// the frame at 1500 is the book at 1500
+		{"last", RESAMPLE_LAST, 0, 2200, [][2]int64{{1000, 1}, {1500, 3}, {2000, 3}}},
+		{"last from a grid time on the first frame", RESAMPLE_LAST, 500, 2200, [][2]int64{{1000, 1}, {1500, 3}, {2000, 3}}},
+		// the book isn't known at 200 and 700
+		{"last from before the first frame", RESAMPLE_LAST, 200, 2200, [][2]int64{{1200, 1}, {1700, 3}, {2200, 3}}},
+		{"last up to a grid time", RESAMPLE_LAST, 0, 1999, [][2]int64{{1000, 1}, {1500, 3}}},
+		{"first after", RESAMPLE_FIRST_AFTER, 0, 2200, [][2]int64{{1000, 1}, {1500, 3}}},
+		{"first after from before the first frame", RESAMPLE_FIRST_AFTER, 200, 2200, [][2]int64{{200, 1}, {700, 1}, {1200, 2}, {1700, 3}}},
+		{"skip unchanged", RESAMPLE_SKIP_UNCHANGED, 0, 2200, [][2]int64{{1000, 1}, {1500, 3}}},
+		{"skip unchanged from before the first frame", RESAMPLE_SKIP_UNCHANGED, 200, 2700, [][2]int64{{1200, 1}, {1700, 3}}},
+	}
+
+	for _, test := range tests {
+		// frames added all at once and one at a time give the same samples
+		for _, batch := range []int{len(frames), 1} {
+			r, err := NewResampler(test.start, 500, test.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			samples := make([]OrderBookSmall, 0)
+			for i := 0; i < len(frames); i += batch {
+				samples = append(samples, r.Add(frames[i:i+batch])...)
+			}
+			samples = append(samples, r.Flush(test.end)...)
+
+			got := make([][2]int64, 0)
+			for _, sample := range samples {
+				got = append(got, [2]int64{sample.Time, sample.Bids[0][0]})
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s in batches of %d: %v, want %v", test.name, batch, got, test.want)
+			}
+		}
+	}
+}
+
+func TestNewResampler(t *testing.T) {
+	if _, err := NewResampler(0, 0, RESAMPLE_LAST); err == nil {
+		t.Error("period of 0 accepted")
+	}
+
+	if _, err := NewResampler(0, 100, "nearest"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+
+	r, err := NewResampler(0, 100, RESAMPLE_LAST)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if samples := r.Flush(1000); len(samples) != 0 {
+		t.Errorf("%d samples without frames", len(samples))
+	}
+}
@@ -0,0 +1,43 @@
+package orderbook
+
+import (
+	"math"
+
+	"github.com/crypto_pickle/internal/utils"
+)
+
+// Scale records the number of decimal places prices and quantities of a symbol
+// are stored with. With PriceDecimals = 2 a price of 3000001 ticks is 30000.01,
+// with QtyDecimals = 5 a quantity of 150000 lots is 1.5.
+type Scale struct {
+	PriceDecimals int32
+	QtyDecimals   int32
+}
+
+func (s Scale) ParsePrice(price string) (int64, error) {
+	return utils.ParseFixed(price, s.PriceDecimals)
+}
+
+func (s Scale) ParseQty(qty string) (int64, error) {
+	return utils.ParseFixed(qty, s.QtyDecimals)
+}
+
+func (s Scale) FormatPrice(ticks int64) string {
+	return utils.FixedToString(ticks, s.PriceDecimals)
+}
+
+func (s Scale) FormatQty(lots int64) string {
+	return utils.FixedToString(lots, s.QtyDecimals)
+}
+
+// Price converts ticks to a float. Only use this for presentation or
+// analytics, the conversion is not exact.
+func (s Scale) Price(ticks int64) float64 {
+	return float64(ticks) / math.Pow10(int(s.PriceDecimals))
+}
+
+// Qty converts lots to a float. Only use this for presentation or analytics,
+// the conversion is not exact.
+func (s Scale) Qty(lots int64) float64 {
+	return float64(lots) / math.Pow10(int(s.QtyDecimals))
+}
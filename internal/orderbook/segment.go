@@ -0,0 +1,183 @@
+package orderbook
+
+import (
+	"bufio"
+	"io"
+	"sort"
+)
+
+// Since FILE_VERSION 3 the body of a file is split at the keyframes of the
+// history into segments, each a history of its own starting with the keyframe
+// book, encoded with the codec and compressed on its own. FileHeader.Index is
+// the frame offset table of the segments, so a reader can seek to the segment
+// of the nearest keyframe and decode only from there.
+//
+// The start of a segment is the book at the frame of its keyframe, so read in
+// order the segments continue each other and their starts are the keyframes of
+// the history.
+
+// IndexEntry locates a segment of the body.
+type IndexEntry struct {
+	Frame  int   `json:"Frame"`  // frame of the book the segment starts with
+	Time   int64 `json:"Time"`   // time of that book
+	Offset int64 `json:"Offset"` // bytes from the start of the body
+}
+
+// segments splits a history at its keyframes.
+func (hist OrderBookHistory) segments() []OrderBookHistory {
+	res := make([]OrderBookHistory, 0, len(hist.Keyframes)+1)
+
+	start, frame := hist.Start, 0
+	for _, keyframe := range hist.Keyframes {
+		if keyframe.Frame <= frame || keyframe.Frame > len(hist.History) {
+			continue
+		}
+
+		res = append(res, OrderBookHistory{
+			Symbol:           hist.Symbol,
+			Start:            start,
+			KeyframeInterval: hist.KeyframeInterval,
+			History:          hist.History[frame:keyframe.Frame],
+		})
+
+		start, frame = keyframe.Book, keyframe.Frame
+	}
+
+	return append(res, OrderBookHistory{
+		Symbol:           hist.Symbol,
+		Start:            start,
+		KeyframeInterval: hist.KeyframeInterval,
+		History:          hist.History[frame:],
+	})
+}
+
+// encodeSegments encodes and compresses every segment of hist, returning the
+// body and its index.
+func encodeSegments(hist OrderBookHistory, codec Codec, compression string, level int) ([]byte, []IndexEntry, error) {
+	segments := hist.segments()
+
+	body := make([]byte, 0)
+	index := make([]IndexEntry, 0, len(segments))
+
+	frame := 0
+	for _, segment := range segments {
+		data, err := codec.Encode(segment)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data, err = Compress(data, compression, level)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		index = append(index, IndexEntry{Frame: frame, Time: segment.Start.Time, Offset: int64(len(body))})
+		body = append(body, data...)
+		frame += len(segment.History)
+	}
+
+	return body, index, nil
+}
+
+// segmentAt returns the segment of the last keyframe at or before t.
+func (header FileHeader) segmentAt(t int64) int {
+	k := sort.Search(len(header.Index), func(k int) bool {
+		return header.Index[k].Time > t
+	}) - 1
+
+	if k < 0 {
+		return 0
+	}
+
+	return k
+}
+
+// segmentReader reads the diffs of every segment from k on, the body must be
+// positioned at the start of segment k.
+type segmentReader struct {
+	body   *bufio.Reader
+	header FileHeader
+	codec  Codec
+	dec    *HistDecoder
+
+	k       int
+	started bool
+	limited *io.LimitedReader
+	closer  io.Closer
+	frames  FrameReader
+}
+
+func newSegmentReader(body *bufio.Reader, header FileHeader, k int, dec *HistDecoder) (*segmentReader, error) {
+	codec, err := GetCodec(header.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &segmentReader{body: body, header: header, codec: codec, dec: dec, k: k}
+	if err := reader.open(); err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// open starts reading segment k. The first segment read is the start of the
+// decoder, later ones are its keyframes.
+func (reader *segmentReader) open() error {
+	index := reader.header.Index
+
+	var r io.Reader = reader.body
+	reader.limited = nil
+	if reader.k+1 < len(index) {
+		reader.limited = &io.LimitedReader{R: reader.body, N: index[reader.k+1].Offset - index[reader.k].Offset}
+		r = reader.limited
+	}
+
+	rc, err := NewDecompressor(r, reader.header.Compression)
+	if err != nil {
+		return err
+	}
+	reader.closer = rc
+
+	segment := &HistDecoder{Version: reader.dec.Version}
+	reader.frames, err = reader.codec.NewFrameReader(rc, segment)
+	if err != nil {
+		return err
+	}
+
+	if !reader.started {
+		reader.started = true
+		reader.dec.Symbol, reader.dec.Start = segment.Symbol, segment.Start
+		reader.dec.KeyframeInterval, reader.dec.Frame = segment.KeyframeInterval, index[reader.k].Frame
+		reader.dec.Keyframes = nil
+	} else {
+		reader.dec.Keyframes = append(reader.dec.Keyframes, Keyframe{Frame: index[reader.k].Frame - reader.dec.Frame, Book: segment.Start})
+	}
+
+	return nil
+}
+
+func (reader *segmentReader) Next() (DepthDiff, error) {
+	for {
+		diff, err := reader.frames.Next()
+		if err != io.EOF || reader.k+1 >= len(reader.header.Index) {
+			return diff, err
+		}
+
+		// whatever the codec left unread of the segment, e.g. a checksum of
+		// the compression, is skipped
+		reader.closer.Close()
+		if _, err := io.Copy(io.Discard, reader.limited); err != nil {
+			return diff, err
+		}
+
+		reader.k++
+		if err := reader.open(); err != nil {
+			return diff, err
+		}
+	}
+}
+
+func (reader *segmentReader) Close() error {
+	return reader.closer.Close()
+}
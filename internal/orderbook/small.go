@@ -2,12 +2,16 @@ package orderbook
 
 import (
 	"sort"
+	"strconv"
+
+	"github.com/crypto_pickle/internal/utils"
 )
 
 type OrderBookSmall struct {
-	Time int64
-	Bids PriceLevelArray
-	Asks PriceLevelArray
+	Time  int64
+	Scale Scale
+	Bids  PriceLevelArray
+	Asks  PriceLevelArray
 }
 
 type OrderBookSmallArray []OrderBookSmall
@@ -39,9 +43,10 @@ func (ob OrderBookSmall) Cut(limit int) OrderBookSmall {
 
 func (ob OrderBook) ToOrderBookSmall() OrderBookSmall {
 	obs := OrderBookSmall{
-		Time: ob.Time,
-		Bids: make(PriceLevelArray, len(ob.Bids)),
-		Asks: make(PriceLevelArray, len(ob.Asks)),
+		Time:  ob.Time,
+		Scale: ob.Scale,
+		Bids:  make(PriceLevelArray, len(ob.Bids)),
+		Asks:  make(PriceLevelArray, len(ob.Asks)),
 	}
 
 	ctr := 0
@@ -68,6 +73,8 @@ func (oba OrderBookSmallArray) GetTimeIndex(t int64) int {
 	return -1
 }
 
+// Cut keeps every 10/freq-th frame, assuming frames are 100ms apart. Use a
+// Resampler to sample by time instead.
 func (oba OrderBookSmallArray) Cut(limit, freq int) OrderBookSmallArray {
 	iter := 10 / freq
 	res := make(OrderBookSmallArray, len(oba)/iter)
@@ -78,3 +85,36 @@ func (oba OrderBookSmallArray) Cut(limit, freq int) OrderBookSmallArray {
 
 	return res
 }
+
+// MarshalJSON writes price levels as exact decimal numbers, e.g. [30000.01,1.5],
+// rather than as raw ticks and lots.
+func (ob OrderBookSmall) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 0, 32+24*(len(ob.Bids)+len(ob.Asks)))
+
+	buf = append(buf, `{"Time":`...)
+	buf = strconv.AppendInt(buf, ob.Time, 10)
+	buf = append(buf, `,"Bids":`...)
+	buf = ob.Scale.appendLevels(buf, ob.Bids)
+	buf = append(buf, `,"Asks":`...)
+	buf = ob.Scale.appendLevels(buf, ob.Asks)
+	buf = append(buf, '}')
+
+	return buf, nil
+}
+
+func (s Scale) appendLevels(buf []byte, levels PriceLevelArray) []byte {
+	buf = append(buf, '[')
+	for i, level := range levels {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+
+		buf = append(buf, '[')
+		buf = utils.AppendFixed(buf, level[0], s.PriceDecimals)
+		buf = append(buf, ',')
+		buf = utils.AppendFixed(buf, level[1], s.QtyDecimals)
+		buf = append(buf, ']')
+	}
+
+	return append(buf, ']')
+}
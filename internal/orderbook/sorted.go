@@ -0,0 +1,197 @@
+package orderbook
+
+import (
+	"github.com/emirpasic/gods/trees/redblacktree"
+	"github.com/emirpasic/gods/utils"
+)
+
+// BookSide is one side of a SortedOrderBook, a red-black tree of price (ticks)
+// to quantity (lots).
+type BookSide struct {
+	tree *redblacktree.Tree
+}
+
+func NewBookSide(levels DepthLevel) BookSide {
+	side := BookSide{tree: redblacktree.NewWith(utils.Int64Comparator)}
+	for price, volume := range levels {
+		side.Set(price, volume)
+	}
+
+	return side
+}
+
+// Set updates the quantity resting at price, removing the level when volume is 0.
+func (side BookSide) Set(price, volume int64) {
+	if volume == 0 {
+		side.tree.Remove(price)
+	} else {
+		side.tree.Put(price, volume)
+	}
+}
+
+func (side BookSide) Get(price int64) (int64, bool) {
+	volume, ok := side.tree.Get(price)
+	if !ok {
+		return 0, false
+	}
+
+	return volume.(int64), true
+}
+
+func (side BookSide) Len() int {
+	return side.tree.Size()
+}
+
+func (side BookSide) Lowest() (PriceLevel, bool) {
+	node := side.tree.Left()
+	if node == nil {
+		return PriceLevel{}, false
+	}
+
+	return PriceLevel{node.Key.(int64), node.Value.(int64)}, true
+}
+
+func (side BookSide) Highest() (PriceLevel, bool) {
+	node := side.tree.Right()
+	if node == nil {
+		return PriceLevel{}, false
+	}
+
+	return PriceLevel{node.Key.(int64), node.Value.(int64)}, true
+}
+
+// LowestN returns up to n of the lowest priced levels in ascending order.
+func (side BookSide) LowestN(n int) PriceLevelArray {
+	if n > side.Len() || n < 0 {
+		n = side.Len()
+	}
+
+	res := make(PriceLevelArray, 0, n)
+	it := side.tree.Iterator()
+	for len(res) < n && it.Next() {
+		res = append(res, PriceLevel{it.Key().(int64), it.Value().(int64)})
+	}
+
+	return res
+}
+
+// HighestN returns up to n of the highest priced levels in ascending order.
+func (side BookSide) HighestN(n int) PriceLevelArray {
+	if n > side.Len() || n < 0 {
+		n = side.Len()
+	}
+
+	res := make(PriceLevelArray, n)
+	it := side.tree.Iterator()
+	it.End()
+	for i := n - 1; i >= 0 && it.Prev(); i-- {
+		res[i] = PriceLevel{it.Key().(int64), it.Value().(int64)}
+	}
+
+	return res
+}
+
+// Range returns the levels with lo <= price <= hi in ascending order.
+func (side BookSide) Range(lo, hi int64) PriceLevelArray {
+	res := make(PriceLevelArray, 0)
+
+	node, ok := side.tree.Ceiling(lo)
+	if !ok {
+		return res
+	}
+
+	it := side.tree.IteratorAt(node)
+	for ok := true; ok && it.Key().(int64) <= hi; ok = it.Next() {
+		res = append(res, PriceLevel{it.Key().(int64), it.Value().(int64)})
+	}
+
+	return res
+}
+
+// Each calls f for every level in ascending price order until f returns false.
+func (side BookSide) Each(f func(price, volume int64) bool) {
+	it := side.tree.Iterator()
+	for it.Next() {
+		if !f(it.Key().(int64), it.Value().(int64)) {
+			return
+		}
+	}
+}
+
+func (side BookSide) ToDepthLevel() DepthLevel {
+	dl := make(DepthLevel, side.Len())
+	side.Each(func(price, volume int64) bool {
+		dl[price] = volume
+		return true
+	})
+
+	return dl
+}
+
+// SortedOrderBook is an OrderBook that keeps both sides ordered by price, so
+// best bid/ask is O(log n) and top-N or range queries don't need a full sort.
+type SortedOrderBook struct {
+	Time        int64
+	UpdateId    int64
+	ReceiveTime int64
+	Scale       Scale
+	Bids        BookSide
+	Asks        BookSide
+}
+
+func (ob OrderBook) ToSortedOrderBook() *SortedOrderBook {
+	return &SortedOrderBook{
+		Time:        ob.Time,
+		UpdateId:    ob.UpdateId,
+		ReceiveTime: ob.ReceiveTime,
+		Scale:       ob.Scale,
+		Bids:        NewBookSide(ob.Bids),
+		Asks:        NewBookSide(ob.Asks),
+	}
+}
+
+// ApplyDepthDiff has the same semantics as OrderBook.ApplyDepthDiff, a volume
+// of 0 removes the level.
+func (ob *SortedOrderBook) ApplyDepthDiff(diff DepthDiff) {
+	ob.Time = diff.Time
+	ob.UpdateId, ob.ReceiveTime = diff.LastUpdateId, diff.ReceiveTime
+
+	for price, volume := range diff.Bids {
+		ob.Bids.Set(price, volume)
+	}
+
+	for price, volume := range diff.Asks {
+		ob.Asks.Set(price, volume)
+	}
+}
+
+func (ob *SortedOrderBook) BestBid() (PriceLevel, bool) {
+	return ob.Bids.Highest()
+}
+
+func (ob *SortedOrderBook) BestAsk() (PriceLevel, bool) {
+	return ob.Asks.Lowest()
+}
+
+// ToOrderBookSmall returns the best limit levels of each side, laid out like
+// OrderBookSmall.SortAndCut does: both sides ascending, best bid last and best
+// ask first.
+func (ob *SortedOrderBook) ToOrderBookSmall(limit int) OrderBookSmall {
+	return OrderBookSmall{
+		Time:  ob.Time,
+		Scale: ob.Scale,
+		Bids:  ob.Bids.HighestN(limit),
+		Asks:  ob.Asks.LowestN(limit),
+	}
+}
+
+func (ob *SortedOrderBook) ToOrderBook() OrderBook {
+	return OrderBook{
+		Time:        ob.Time,
+		UpdateId:    ob.UpdateId,
+		ReceiveTime: ob.ReceiveTime,
+		Scale:       ob.Scale,
+		Bids:        ob.Bids.ToDepthLevel(),
+		Asks:        ob.Asks.ToDepthLevel(),
+	}
+}
@@ -0,0 +1,90 @@
+package orderbook
+
+import (
+	"reflect"
+	"testing"
+)
+
+// levelsIn returns the levels of dl with lo <= price <= hi in ascending order.
+func levelsIn(dl DepthLevel, lo, hi int64) PriceLevelArray {
+	res := make(PriceLevelArray, 0)
+	for _, level := range sortedLevels(dl) {
+		if level[0] >= lo && level[0] <= hi {
+			res = append(res, level)
+		}
+	}
+
+	return res
+}
+
+func TestSortedOrderBook(t *testing.T) {
+	hist := testHistory(200)
+
+	ob := hist.Start.Copy()
+	sorted := hist.Start.ToSortedOrderBook()
+
+	for i, diff := range hist.History {
+		ob.ApplyDepthDiff(diff)
+		sorted.ApplyDepthDiff(diff)
+
+		if !reflect.DeepEqual(sorted.ToOrderBook(), ob) {
+			t.Fatalf("frame %d: sorted book differs from the map book", i+1)
+		}
+
+		bids, asks := sortedLevels(ob.Bids), sortedLevels(ob.Asks)
+		if bestBid, ok := sorted.BestBid(); !ok || bestBid != bids[len(bids)-1] {
+			t.Errorf("frame %d: best bid %v, want %v", i+1, bestBid, bids[len(bids)-1])
+		}
+
+		if bestAsk, ok := sorted.BestAsk(); !ok || bestAsk != asks[0] {
+			t.Errorf("frame %d: best ask %v, want %v", i+1, bestAsk, asks[0])
+		}
+
+		small := ob.ToOrderBookSmall()
+		small.SortAndCut(10)
+		if !reflect.DeepEqual(sorted.ToOrderBookSmall(10), small) {
+			t.Errorf("frame %d: top 10 levels differ", i+1)
+		}
+
+		// a range starting and ending between levels
+		lo, hi := bids[0][0]-1, bids[len(bids)/2][0]+1
+		if got := sorted.Bids.Range(lo, hi); !reflect.DeepEqual(got, levelsIn(ob.Bids, lo, hi)) {
+			t.Errorf("frame %d: bids from %d to %d %v", i+1, lo, hi, got)
+		}
+	}
+
+	// n past the size of a side, or negative, returns the whole side
+	for _, n := range []int{-1, sorted.Bids.Len(), sorted.Bids.Len() + 5} {
+		if got := sorted.Bids.HighestN(n); !reflect.DeepEqual(got, sortedLevels(ob.Bids)) {
+			t.Errorf("highest %d bids %v", n, got)
+		}
+	}
+
+	for _, n := range []int{-1, sorted.Asks.Len(), sorted.Asks.Len() + 5} {
+		if got := sorted.Asks.LowestN(n); !reflect.DeepEqual(got, sortedLevels(ob.Asks)) {
+			t.Errorf("lowest %d asks %v", n, got)
+		}
+	}
+
+	if got := sorted.Asks.Range(1, 2); len(got) != 0 {
+		t.Errorf("asks below the book %v", got)
+	}
+}
+
+func TestEmptySortedOrderBook(t *testing.T) {
+	sorted := OrderBook{Bids: DepthLevel{100: 1}, Asks: DepthLevel{}}.ToSortedOrderBook()
+	sorted.ApplyDepthDiff(DepthDiff{Bids: DepthLevel{100: 0}, Asks: DepthLevel{101: 0}})
+
+	if _, ok := sorted.BestBid(); ok {
+		t.Error("best bid of an empty side")
+	}
+
+	if _, ok := sorted.BestAsk(); ok {
+		t.Error("best ask of an empty side")
+	}
+
+	small := sorted.ToOrderBookSmall(10)
+	if len(small.Bids) != 0 || len(small.Asks) != 0 || sorted.Bids.Len() != 0 {
+		t.Errorf("empty book %+v", small)
+	}
+}
@@ -0,0 +1,45 @@
+package orderbook
+
+import "sort"
+
+// Stitcher joins the frames of consecutive histories into one selection of
+// [Start, End]. The selection begins with the book in force at Start (the last
+// frame at or before it) and frames repeating the time range of an earlier
+// window are dropped, histories overlap by the changeover frames of the miner.
+type Stitcher struct {
+	Start int64
+	End   int64
+
+	last    int64
+	started bool
+}
+
+func NewStitcher(start, end int64) *Stitcher {
+	return &Stitcher{Start: start, End: end}
+}
+
+// Add returns the part of the next window that belongs to the selection.
+// Windows have to be added in time order.
+func (s *Stitcher) Add(window []OrderBookSmall) []OrderBookSmall {
+	var lo int
+	if s.started {
+		lo = sort.Search(len(window), func(i int) bool { return window[i].Time > s.last })
+	} else if lo = sort.Search(len(window), func(i int) bool { return window[i].Time > s.Start }); lo > 0 {
+		lo--
+	}
+
+	hi := sort.Search(len(window), func(i int) bool { return window[i].Time > s.End })
+	if lo >= hi {
+		return nil
+	}
+
+	s.started = true
+	s.last = window[hi-1].Time
+
+	return window[lo:hi]
+}
+
+// Done reports whether a window ending at end completes the selection.
+func (s *Stitcher) Done(end int64) bool {
+	return end >= s.End
+}
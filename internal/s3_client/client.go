@@ -2,6 +2,8 @@ package s3_client
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"log"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -55,6 +57,49 @@ func (client *S3Client) DownloadData(bucketName string, keyString string) []byte
 	return bufferWriter.Bytes()
 }
 
+// OpenData streams an object instead of buffering it. The caller must close
+// the returned reader.
+func (client *S3Client) OpenData(bucketName string, keyString string) (io.ReadCloser, error) {
+	svc := s3.New(client.sess)
+
+	output, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(keyString),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+// OpenDataRange is OpenData starting offset bytes into the object.
+func (client *S3Client) OpenDataRange(bucketName string, keyString string, offset int64) (io.ReadCloser, error) {
+	svc := s3.New(client.sess)
+
+	output, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(keyString),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-", offset)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+func (client *S3Client) DeleteData(bucketName string, keyString string) error {
+	svc := s3.New(client.sess)
+
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(keyString),
+	})
+
+	return err
+}
+
 func (client *S3Client) ListObjects(bucketName string, prefix string) []string {
 	svc := s3.New(client.sess)
 
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/crypto_pickle/internal/orderbook"
+)
+
+// Key identifies a history file, {symbol}/{start}-{end}.{format} with an
+// optional compression extension, e.g. btcusdt/1-2.msgpack.zst.
+type Key struct {
+	Symbol      string
+	Start       int64
+	End         int64
+	Format      string
+	Compression string
+}
+
+func ParseKey(key string) (Key, error) {
+	var res Key
+
+	symbol, name, ok := strings.Cut(key, "/")
+	if !ok {
+		return res, fmt.Errorf("key %s has no symbol", key)
+	}
+
+	times, format, ok := strings.Cut(name, ".")
+	if !ok {
+		return res, fmt.Errorf("key %s has no format", key)
+	}
+
+	format, ext, _ := strings.Cut(format, ".")
+	res.Compression = orderbook.CompressionFromExtension(ext)
+
+	start, end, ok := strings.Cut(times, "-")
+	if !ok {
+		return res, fmt.Errorf("key %s has no time range", key)
+	}
+
+	var err error
+	if res.Start, err = strconv.ParseInt(start, 10, 64); err != nil {
+		return res, err
+	}
+
+	if res.End, err = strconv.ParseInt(end, 10, 64); err != nil {
+		return res, err
+	}
+
+	res.Symbol, res.Format = symbol, format
+
+	return res, nil
+}
+
+func (key Key) String() string {
+	name := fmt.Sprintf("%s/%d-%d.%s", key.Symbol, key.Start, key.End, key.Format)
+	if ext := orderbook.CompressionExtension(key.Compression); ext != "" {
+		name += "." + ext
+	}
+
+	return name
+}
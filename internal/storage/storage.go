@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/crypto_pickle/internal/s3_client"
+)
+
+// Store is a flat key value store of history files, keyed like the miner
+// names them: {symbol}/{start}-{end}.{format}.
+type Store interface {
+	List(prefix string) ([]string, error)
+	Open(key string) (io.ReadCloser, error)
+	// OpenAt is Open starting offset bytes into the file.
+	OpenAt(key string, offset int64) (io.ReadCloser, error)
+	Get(key string) ([]byte, error)
+	Put(key string, data []byte) error
+	Delete(key string) error
+}
+
+// Local stores files under a directory on disk.
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+func (store *Local) path(key string) string {
+	return filepath.Join(store.root, filepath.FromSlash(key))
+}
+
+func (store *Local) List(prefix string) ([]string, error) {
+	res := make([]string, 0, 100)
+
+	err := filepath.WalkDir(store.root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(store.root, path)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			res = append(res, key)
+		}
+
+		return nil
+	})
+
+	sort.Strings(res)
+
+	return res, err
+}
+
+func (store *Local) Open(key string) (io.ReadCloser, error) {
+	return os.Open(store.path(key))
+}
+
+func (store *Local) OpenAt(key string, offset int64) (io.ReadCloser, error) {
+	file, err := os.Open(store.path(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (store *Local) Get(key string) ([]byte, error) {
+	return os.ReadFile(store.path(key))
+}
+
+func (store *Local) Put(key string, data []byte) error {
+	path := store.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, os.ModePerm)
+}
+
+func (store *Local) Delete(key string) error {
+	return os.Remove(store.path(key))
+}
+
+// S3 stores files in a bucket.
+type S3 struct {
+	client *s3_client.S3Client
+	bucket string
+}
+
+func NewS3(client *s3_client.S3Client, bucket string) *S3 {
+	return &S3{client: client, bucket: bucket}
+}
+
+func (store *S3) List(prefix string) ([]string, error) {
+	return store.client.ListObjects(store.bucket, prefix), nil
+}
+
+func (store *S3) Open(key string) (io.ReadCloser, error) {
+	return store.client.OpenData(store.bucket, key)
+}
+
+func (store *S3) OpenAt(key string, offset int64) (io.ReadCloser, error) {
+	return store.client.OpenDataRange(store.bucket, key, offset)
+}
+
+func (store *S3) Get(key string) ([]byte, error) {
+	body, err := store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(body)
+
+	return buf.Bytes(), err
+}
+
+func (store *S3) Put(key string, data []byte) error {
+	store.client.UploadData(store.bucket, key, data)
+	return nil
+}
+
+func (store *S3) Delete(key string) error {
+	return store.client.DeleteData(store.bucket, key)
+}
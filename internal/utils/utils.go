@@ -1,16 +1,81 @@
 package utils
 
 import (
+	"fmt"
 	"strconv"
-	"log"
+	"strings"
 )
 
+// ParseFixed parses a decimal string such as "30000.01000000" into an integer
+// number of units with the given number of decimal places. Digits beyond the
+// scale must be zero, otherwise the value cannot be represented exactly.
+func ParseFixed(s string, decimals int32) (int64, error) {
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > int(decimals) {
+		if strings.Trim(frac[decimals:], "0") != "" {
+			return 0, fmt.Errorf("%s has more than %d decimal places", s, decimals)
+		}
+		frac = frac[:decimals]
+	}
+	frac += strings.Repeat("0", int(decimals)-len(frac))
+
+	if whole == "" {
+		whole = "0"
+	}
 
-func StringToFloat(s string) float32 {
-	f, err := strconv.ParseFloat(s, 64)
+	v, err := strconv.ParseInt(whole+frac, 10, 64)
 	if err != nil {
-		log.Fatal("Error: ", err)
+		return 0, err
+	}
+
+	if neg {
+		v = -v
+	}
+
+	return v, nil
+}
+
+// AppendFixed appends the decimal representation of v with the given number of
+// decimal places to dst, trimming trailing zeros.
+func AppendFixed(dst []byte, v int64, decimals int32) []byte {
+	if v < 0 {
+		dst = append(dst, '-')
+		v = -v
 	}
 
-	return float32(f)
-}
\ No newline at end of file
+	digits := strconv.FormatInt(v, 10)
+	if decimals <= 0 {
+		return append(dst, digits...)
+	}
+
+	if len(digits) <= int(decimals) {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+
+	point := len(digits) - int(decimals)
+	frac := strings.TrimRight(digits[point:], "0")
+
+	dst = append(dst, digits[:point]...)
+	if frac != "" {
+		dst = append(dst, '.')
+		dst = append(dst, frac...)
+	}
+
+	return dst
+}
+
+func FixedToString(v int64, decimals int32) string {
+	return string(AppendFixed(nil, v, decimals))
+}
+
+// DecimalPlaces returns the number of significant decimal places in a step
+// size such as "0.01000000" (2) or "10.00000000" (0).
+func DecimalPlaces(s string) int32 {
+	_, frac, _ := strings.Cut(s, ".")
+	return int32(len(strings.TrimRight(frac, "0")))
+}
@@ -3,12 +3,58 @@ CryptoPickles Orderbook Reader
 Reconstructs full orderbooks from the hybrid snapshot+diff format
 """
 
+import gzip
 import json
 import os
 from pathlib import Path
 from typing import Dict, List, Tuple, Optional
 from datetime import datetime
 import bisect
+import struct
+
+
+def from_fixed(price: str, volume: str, scale: Optional[Dict]) -> Tuple[float, float]:
+    """Convert a (ticks, lots) pair to floats using a Scale dict from the file"""
+    scale = scale or {}
+    return (
+        int(price) / 10 ** scale.get('PriceDecimals', 0),
+        int(volume) / 10 ** scale.get('QtyDecimals', 0),
+    )
+
+
+FILE_MAGIC = b'CPKL'
+
+
+def read_history_file(filepath: str) -> Tuple[Optional[Dict], Dict]:
+    """Read a history file, returning its header and decoded body.
+
+    Files start with the magic bytes CPKL, a big endian uint16 version, a big
+    endian uint32 header length and a JSON header naming the body's codec.
+    Headerless files were written by legacy miners and must be migrated with
+    cmd/migrate first. Only the json codec with no or gzip compression can be
+    read without extra packages.
+    """
+    with open(filepath, 'rb') as f:
+        raw = f.read()
+
+    if raw[:4] != FILE_MAGIC:
+        raise ValueError(f"{filepath} has no header, migrate it with cmd/migrate")
+
+    version = struct.unpack('>H', raw[4:6])[0]
+    header_len = struct.unpack('>I', raw[6:10])[0]
+    header = json.loads(raw[10:10 + header_len])
+    header['Version'] = version
+
+    if header['Codec'] != 'json':
+        raise ValueError(f"{filepath} uses the {header['Codec']} codec, only json is supported")
+
+    body = raw[10 + header_len:]
+    if header.get('Compression') == 'gzip':
+        body = gzip.decompress(body)
+    elif header.get('Compression', 'none') != 'none':
+        raise ValueError(f"{filepath} uses {header['Compression']} compression, only gzip is supported")
+
+    return header, json.loads(body)
 
 
 class OrderBook:
@@ -19,14 +65,14 @@ class OrderBook:
         self.bids = bids.copy()
         self.asks = asks.copy()
     
-    def apply_diff(self, diff: Dict) -> 'OrderBook':
-        """Apply a depth diff to this orderbook"""
+    def apply_diff(self, diff: Dict, scale: Optional[Dict] = None) -> 'OrderBook':
+        """Apply a depth diff to this orderbook. Prices and volumes in the diff are
+        stored as integer ticks and lots and are converted using the file's scale"""
         self.time = diff['Time']
         
         # Apply bid changes
         for price_str, volume_str in diff['Bids'].items():
-            price = float(price_str)
-            volume = float(volume_str)
+            price, volume = from_fixed(price_str, volume_str, scale)
             if volume == 0:
                 self.bids.pop(price, None)
             else:
@@ -34,8 +80,7 @@ class OrderBook:
         
         # Apply ask changes
         for price_str, volume_str in diff['Asks'].items():
-            price = float(price_str)
-            volume = float(volume_str)
+            price, volume = from_fixed(price_str, volume_str, scale)
             if volume == 0:
                 self.asks.pop(price, None)
             else:
@@ -84,16 +129,16 @@ class OrderBookHistory:
     
     def __init__(self, filepath: str):
         self.filepath = filepath
-        with open(filepath, 'r') as f:
-            data = json.load(f)
+        self.header, data = read_history_file(filepath)
         
         self.symbol = data['Symbol']
         
         # Parse start orderbook
         start_data = data['Start']
         self.start_time = start_data['Time']
-        bids = {float(k): float(v) for k, v in start_data['Bids'].items()}
-        asks = {float(k): float(v) for k, v in start_data['Asks'].items()}
+        self.scale = start_data.get('Scale')
+        bids = dict(from_fixed(k, v, self.scale) for k, v in start_data['Bids'].items())
+        asks = dict(from_fixed(k, v, self.scale) for k, v in start_data['Asks'].items())
         
         self.history = data['History']
         self.timestamps = [self.start_time] + [diff['Time'] for diff in self.history]
@@ -107,13 +152,11 @@ class OrderBookHistory:
             raise IndexError(f"Index {index} out of range [0, {len(self.history)}]")
         
         # Start with the initial orderbook
-        bids = {float(k): float(v) for k, v in self._start_orderbook.bids.items()}
-        asks = {float(k): float(v) for k, v in self._start_orderbook.asks.items()}
-        ob = OrderBook(self.start_time, bids, asks)
+        ob = OrderBook(self.start_time, self._start_orderbook.bids, self._start_orderbook.asks)
         
         # Apply diffs up to the index
         for i in range(index):
-            ob.apply_diff(self.history[i])
+            ob.apply_diff(self.history[i], self.scale)
         
         return ob
     
@@ -132,14 +175,12 @@ class OrderBookHistory:
         orderbooks = []
         
         # Start with initial orderbook
-        bids = {float(k): float(v) for k, v in self._start_orderbook.bids.items()}
-        asks = {float(k): float(v) for k, v in self._start_orderbook.asks.items()}
-        ob = OrderBook(self.start_time, bids, asks)
+        ob = OrderBook(self.start_time, self._start_orderbook.bids, self._start_orderbook.asks)
         orderbooks.append(OrderBook(ob.time, ob.bids.copy(), ob.asks.copy()))
         
         # Apply each diff
         for diff in self.history:
-            ob.apply_diff(diff)
+            ob.apply_diff(diff, self.scale)
             orderbooks.append(OrderBook(ob.time, ob.bids.copy(), ob.asks.copy()))
         
         return orderbooks
@@ -161,9 +202,9 @@ class OrderBookDataset:
     def _discover_files(self) -> List[Path]:
         """Find all JSON files in the directory"""
         if self.symbol:
-            pattern = f"{self.symbol}/*.json"
+            pattern = f"{self.symbol}/*.json*"
         else:
-            pattern = "**/*.json"
+            pattern = "**/*.json*"
         
         files = sorted(self.directory.glob(pattern))
         return files
@@ -172,8 +213,8 @@ class OrderBookDataset:
         """Build an index of (start_time, end_time, filepath)"""
         ranges = []
         for filepath in self.files:
-            # Parse timestamps from filename: {start}-{end}.json
-            filename = filepath.stem
+            # Parse timestamps from filename: {start}-{end}.json[.gz]
+            filename = filepath.name.split('.')[0]
             try:
                 start_str, end_str = filename.split('-')
                 start = int(start_str)